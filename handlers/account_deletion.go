@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/DmitrijP/my-go-server/internal/lockout"
+	"github.com/DmitrijP/my-go-server/internal/mail"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultAccountDeletionGrace is used when ApiConfig.AccountDeletionGrace
+	// is not set.
+	DefaultAccountDeletionGrace = 14 * 24 * time.Hour
+	// Deleting the account needs a login at most this old, a refreshed
+	// token is not enough.
+	deletionReauthWindow = 10 * time.Minute
+	purgeBatchSize       = 100
+)
+
+type account_deletion_response struct {
+	DeletionScheduledAt string `json:"deletion_scheduled_at"`
+}
+
+// DeleteAccountHandler schedules the deletion of the calling user. Until the
+// grace period ends the user can still log in and cancel it.
+func (cfg *ApiConfig) DeleteAccountHandler(w http.ResponseWriter, req *http.Request) {
+	principal := PrincipalFromContext(req.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	if principal.AuthTime.IsZero() || time.Since(principal.AuthTime) > deletionReauthWindow {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", max_age=%d`, int(deletionReauthWindow.Seconds())))
+		respondWithError(w, http.StatusUnauthorized, "Please log in again to delete your account")
+		return
+	}
+
+	grace := cfg.AccountDeletionGrace
+	if grace == 0 {
+		grace = DefaultAccountDeletionGrace
+	}
+	deleteAt := time.Now().Add(grace)
+
+	scheduled, err := cfg.Db.ScheduleUserDeletion(req.Context(), database.ScheduleUserDeletionParams{
+		ID:                  principal.UserID,
+		DeletionScheduledAt: sql.NullTime{Time: deleteAt, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error scheduling account deletion: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if scheduled == 0 {
+		respondWithError(w, http.StatusConflict, "Account deletion already scheduled")
+		return
+	}
+
+	usr, err := cfg.Db.SelectUserById(req.Context(), principal.UserID)
+	if err == nil {
+		cfg.sendMail(mail.Message{
+			To:      usr.Email,
+			Subject: "Your Chirpy account will be deleted",
+			Body: fmt.Sprintf("Your Chirpy account and all of its data will be deleted on %s.\n\n"+
+				"If you did not request this, log in before then and cancel the deletion.",
+				deleteAt.Format(time.RFC1123)),
+		})
+	}
+
+	respondWithJSON(w, http.StatusAccepted, account_deletion_response{DeletionScheduledAt: deleteAt.String()})
+}
+
+func (cfg *ApiConfig) CancelAccountDeletionHandler(w http.ResponseWriter, req *http.Request) {
+	principal := PrincipalFromContext(req.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	cancelled, err := cfg.Db.CancelUserDeletion(req.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("Error cancelling account deletion: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if cancelled == 0 {
+		respondWithError(w, http.StatusNotFound, "No account deletion scheduled")
+		return
+	}
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+// RunAccountPurge deletes accounts whose grace period is over, every
+// interval until ctx is done. All rows of a user reference it with ON DELETE
+// CASCADE, so removing the user removes their chirps, tokens, passkeys and
+// identities as well. Each purge records a user.deleted event in
+// outbox_events within the same statement.
+func (cfg *ApiConfig) RunAccountPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cfg.purgeDeletedAccounts(ctx)
+		cfg.purgeExpiredChallenges(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeExpiredChallenges removes passkey challenges that were never
+// answered. Anyone can start a passkey login, so they would pile up.
+func (cfg *ApiConfig) purgeExpiredChallenges(ctx context.Context) {
+	deleted, err := cfg.Db.DeleteExpiredWebAuthnChallenges(ctx)
+	if err != nil {
+		log.Printf("Error deleting expired passkey challenges: %s", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d expired passkey challenges", deleted)
+	}
+}
+
+func (cfg *ApiConfig) purgeDeletedAccounts(ctx context.Context) {
+	for {
+		ids, err := cfg.Db.ListUsersDueForDeletion(ctx, purgeBatchSize)
+		if err != nil {
+			log.Printf("Error selecting accounts to delete: %s", err)
+			return
+		}
+		for _, id := range ids {
+			err = cfg.purgeAccount(ctx, id)
+			if err != nil {
+				log.Printf("Error deleting account %s: %s", id, err)
+				return
+			}
+		}
+		if len(ids) < purgeBatchSize {
+			return
+		}
+	}
+}
+
+// purgeAccount deletes the user row, which cascades to everything else kept
+// in the database. Export archives and uploaded imports on disk and the
+// login counters keyed by email are not tied to the row and are removed
+// afterwards.
+func (cfg *ApiConfig) purgeAccount(ctx context.Context, id uuid.UUID) error {
+	usr, err := cfg.Db.SelectUserById(ctx, id)
+	if err != nil {
+		return err
+	}
+	exports, err := cfg.Db.ListJobIDsByUser(ctx, database.ListJobIDsByUserParams{UserID: id, Type: jobTypeExport})
+	if err != nil {
+		return err
+	}
+	imports, err := cfg.Db.ListJobPayloadsByUser(ctx, database.ListJobPayloadsByUserParams{UserID: id, Type: jobTypeImport})
+	if err != nil {
+		return err
+	}
+
+	purged, err := cfg.Db.PurgeUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if purged == 0 {
+		return nil
+	}
+	log.Printf("Deleted account %s", id)
+
+	for _, jobId := range exports {
+		files, _ := filepath.Glob(filepath.Join(cfg.ExportDir, jobId.String()+"-*.tmp"))
+		for _, file := range append(files, cfg.exportPath(jobId)) {
+			err = os.Remove(file)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("Error deleting export %s: %s", file, err)
+			}
+		}
+	}
+	for _, raw := range imports {
+		var payload import_payload
+		if json.Unmarshal(raw, &payload) != nil || payload.File == "" {
+			continue
+		}
+		file := filepath.Join(cfg.ImportDir, filepath.Base(payload.File))
+		err = os.Remove(file)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Error deleting import %s: %s", file, err)
+		}
+	}
+	for _, limiter := range []*lockout.Limiter{cfg.LoginLimiter, cfg.MailLimiter} {
+		err = limiter.Forget(ctx, usr.Email)
+		if err != nil {
+			log.Printf("Error deleting login attempts of %s: %s", id, err)
+		}
+	}
+	return nil
+}
@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"database/sql"
+	"log"
 	"net/http"
 	"os"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
 )
 
 func (cfg *ApiConfig) MetricsReset(w http.ResponseWriter, req *http.Request) {
@@ -22,3 +28,44 @@ func (cfg *ApiConfig) MetricsReset(w http.ResponseWriter, req *http.Request) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 }
+
+// SuspendUserHandler locks a user out. Running sessions end at once and new
+// logins are refused until the suspension is lifted.
+func (cfg *ApiConfig) SuspendUserHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.setSuspended(w, req, sql.NullTime{Time: time.Now(), Valid: true})
+}
+
+func (cfg *ApiConfig) UnsuspendUserHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.setSuspended(w, req, sql.NullTime{})
+}
+
+func (cfg *ApiConfig) setSuspended(w http.ResponseWriter, req *http.Request, suspendedAt sql.NullTime) {
+	w.Header().Set("Content-Type", "application/json")
+	userUuid, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing user id: %s", err)
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	updated, err := cfg.Db.SetUserSuspended(req.Context(), database.SetUserSuspendedParams{ID: userUuid, SuspendedAt: suspendedAt})
+	if err != nil {
+		log.Printf("Error updating user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if updated == 0 {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if suspendedAt.Valid {
+		err = cfg.invalidateSessions(req.Context(), userUuid)
+		if err != nil {
+			log.Printf("Error invalidating sessions: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+	}
+	respondWithoutBody(w, http.StatusNoContent)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -16,11 +17,25 @@ type user_create struct {
 }
 
 type user_create_response struct {
-	Id          string `json:"id"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
-	Email       string `json:"email"`
-	IsChirpyRed bool   `json:"is_chirpy_red"`
+	Id            string `json:"id"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+	Email         string `json:"email"`
+	IsChirpyRed   bool   `json:"is_chirpy_red"`
+	EmailVerified bool   `json:"email_verified"`
+	// Username is null until the user picks one.
+	Username *string `json:"username"`
+}
+
+type username_update struct {
+	Username *string `json:"username"`
+}
+
+func usernameOf(usr database.User) *string {
+	if !usr.Username.Valid {
+		return nil
+	}
+	return &usr.Username.String
 }
 
 func ReadinessHandler(w http.ResponseWriter, req *http.Request) {
@@ -45,19 +60,7 @@ func (cfg *ApiConfig) MetricsShow(w http.ResponseWriter, req *http.Request) {
 }
 
 func (cfg *ApiConfig) ChangeUserPasswordHandler(w http.ResponseWriter, req *http.Request) {
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		log.Printf("Error fetching Bearer Token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
-
-	id, err := auth.ValidateJWT(token, cfg.Jwt_secret)
-	if err != nil {
-		log.Printf("Error validating jwt: %s", err)
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
+	id := PrincipalFromContext(req.Context()).UserID
 
 	usr, err := cfg.Db.SelectUserById(req.Context(), id)
 	if err != nil {
@@ -76,6 +79,14 @@ func (cfg *ApiConfig) ChangeUserPasswordHandler(w http.ResponseWriter, req *http
 		respondWithError(w, http.StatusUnauthorized, "Something went wrong")
 		return
 	}
+	if !validEmail(params.Email) {
+		respondWithValidationErrors(w, map[string][]string{"email": {"must be an email address"}})
+		return
+	}
+	if problems := cfg.PasswordPolicy.Check(params.Password, params.Email); len(problems) > 0 {
+		respondWithValidationErrors(w, map[string][]string{"password": problems})
+		return
+	}
 	hpass, err := auth.HashPassword(params.Password)
 	if err != nil {
 		log.Printf("Error hashing password: %s", err)
@@ -98,12 +109,35 @@ func (cfg *ApiConfig) ChangeUserPasswordHandler(w http.ResponseWriter, req *http
 		return
 	}
 
+	// Sessions that may have been opened with the old password end here,
+	// the client has to log in again.
+	err = cfg.invalidateSessions(req.Context(), id)
+	if err != nil {
+		log.Printf("Error invalidating sessions: %s", err)
+	}
+
+	if updtUsr.Email != usr.Email {
+		err = cfg.sendEmailVerification(req.Context(), updtUsr)
+		if err != nil {
+			log.Printf("Error sending verification: %s", err)
+		}
+	}
+
+	isRed, err := cfg.isChirpyRed(req.Context(), updtUsr.ID)
+	if err != nil {
+		log.Printf("Error selecting subscription: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
 	res := user_create_response{
-		Id:          updtUsr.ID.String(),
-		Email:       updtUsr.Email,
-		CreatedAt:   updtUsr.CreatedAt.String(),
-		UpdatedAt:   updtUsr.UpdatedAt.String(),
-		IsChirpyRed: updtUsr.IsChirpyRed,
+		Id:            updtUsr.ID.String(),
+		Email:         updtUsr.Email,
+		CreatedAt:     updtUsr.CreatedAt.String(),
+		UpdatedAt:     updtUsr.UpdatedAt.String(),
+		IsChirpyRed:   isRed,
+		EmailVerified: updtUsr.EmailVerifiedAt.Valid,
+		Username:      usernameOf(updtUsr),
 	}
 	respondWithJSON(w, http.StatusOK, res)
 }
@@ -120,6 +154,14 @@ func (cfg *ApiConfig) UsersHandler(w http.ResponseWriter, req *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
+	if !validEmail(params.Email) {
+		respondWithValidationErrors(w, map[string][]string{"email": {"must be an email address"}})
+		return
+	}
+	if problems := cfg.PasswordPolicy.Check(params.Password, params.Email); len(problems) > 0 {
+		respondWithValidationErrors(w, map[string][]string{"password": problems})
+		return
+	}
 	hpass, err := auth.HashPassword(params.Password)
 	if err != nil {
 		log.Printf("Error hashing password: %s", err)
@@ -133,11 +175,51 @@ func (cfg *ApiConfig) UsersHandler(w http.ResponseWriter, req *http.Request) {
 		respondWithError(w, http.StatusConflict, "User may already exist")
 		return
 	}
+	err = cfg.sendEmailVerification(req.Context(), user)
+	if err != nil {
+		log.Printf("Error sending verification: %s", err)
+	}
+
 	resObj := user_create_response{
-		Id:          user.ID.String(),
-		CreatedAt:   user.CreatedAt.String(),
-		UpdatedAt:   user.UpdatedAt.String(),
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed}
+		Id:            user.ID.String(),
+		CreatedAt:     user.CreatedAt.String(),
+		UpdatedAt:     user.UpdatedAt.String(),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid}
 	respondWithJSON(w, http.StatusCreated, resObj)
 }
+
+// UpdateUsernameHandler sets the name others use to mention the caller in
+// chirps as @username, null removes it.
+func (cfg *ApiConfig) UpdateUsernameHandler(w http.ResponseWriter, req *http.Request) {
+	id := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+
+	params := username_update{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+	username := sql.NullString{}
+	if params.Username != nil {
+		if !validUsername(*params.Username) {
+			respondWithValidationErrors(w, map[string][]string{"username": {"must be 3 to 30 lowercase letters, digits or underscores"}})
+			return
+		}
+		username = sql.NullString{String: *params.Username, Valid: true}
+	}
+
+	err = cfg.Db.UpdateUsername(req.Context(), database.UpdateUsernameParams{ID: id, Username: username})
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "Username is already taken")
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating username: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, params)
+}
@@ -1,13 +1,20 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/DmitrijP/my-go-server/internal/auth"
 	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
 )
 
 type refresh_model struct {
@@ -20,13 +27,29 @@ type auth_model struct {
 }
 
 type user_model struct {
-	Id           string `json:"id"`
-	CreatedAt    string `json:"created_at"`
-	UpdatedAt    string `json:"updated_at"`
-	Email        string `json:"email"`
-	IsChirpyRed  bool   `json:"is_chirpy_red"`
-	Token        string `json:"token"`
-	RefreshToken string `json:"refresh_token"`
+	Id            string `json:"id"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+	Email         string `json:"email"`
+	IsChirpyRed   bool   `json:"is_chirpy_red"`
+	EmailVerified bool   `json:"email_verified"`
+	Token         string `json:"token,omitempty"`
+	RefreshToken  string `json:"refresh_token,omitempty"`
+	// DeletionScheduledAt is set while a requested account deletion can
+	// still be cancelled.
+	DeletionScheduledAt *string `json:"deletion_scheduled_at,omitempty"`
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = auth.HashPassword("chirpy-dummy-password")
+	})
+	return dummyHash
 }
 
 func (cfg *ApiConfig) LoginHandler(w http.ResponseWriter, req *http.Request) {
@@ -42,23 +65,78 @@ func (cfg *ApiConfig) LoginHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	expirationTime := 60 * 60
+	ip := clientIP(req, cfg.TrustedProxies)
+	retryAfter, err := cfg.LoginLimiter.RetryAfter(req.Context(), params.Email, ip)
+	if err != nil {
+		log.Printf("Error checking login attempts: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts")
+		return
+	}
 
 	usr, err := cfg.Db.SelectUserByEmail(req.Context(), params.Email)
-	if err != nil {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		log.Printf("Error selecting user: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, usr.HashedPassword)
+	// Unknown emails are checked against a dummy hash so they take as long
+	// and answer the same as a wrong password.
+	hash := usr.HashedPassword
 	if err != nil {
-		log.Printf("Error comparing passwords: %s", err)
+		hash = dummyPasswordHash()
+	}
+	pwErr := auth.CheckPasswordHash(params.Password, hash)
+	if err != nil || pwErr != nil {
+		log.Printf("Failed login for %q from %s", params.Email, ip)
+		err = cfg.LoginLimiter.Failed(req.Context(), params.Email, ip)
+		if err != nil {
+			log.Printf("Error recording login attempt: %s", err)
+		}
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
 		return
 	}
 
-	token, err := auth.MakeJWT(usr.ID, cfg.Jwt_secret, time.Duration(expirationTime)*time.Second)
+	err = cfg.LoginLimiter.Succeeded(req.Context(), params.Email)
+	if err != nil {
+		log.Printf("Error resetting login attempts: %s", err)
+	}
+
+	if auth.NeedsRehash(usr.HashedPassword) {
+		hpass, err := auth.HashPassword(params.Password)
+		if err == nil {
+			err = cfg.Db.UpdatePassword(req.Context(), database.UpdatePasswordParams{ID: usr.ID, HashedPassword: hpass})
+		}
+		if err != nil {
+			log.Printf("Error rehashing password: %s", err)
+		}
+	}
+
+	cfg.issueSession(w, req, usr, wantsCookieSession(req))
+}
+
+// issueSession answers a successful login with a new JWT and refresh token.
+// Every login method ends here, so they all return the same user_model. In
+// cookie mode the tokens go into HttpOnly cookies instead of the body.
+func (cfg *ApiConfig) issueSession(w http.ResponseWriter, req *http.Request, usr database.User, cookieMode bool) {
+	if usr.SuspendedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Account suspended")
+		return
+	}
+	isRed, err := cfg.isChirpyRed(req.Context(), usr.ID)
+	if err != nil {
+		log.Printf("Error selecting subscription: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	expirationTime := 60 * 60
+
+	token, err := auth.MakeLoginJWT(usr.ID, cfg.JwtKeys, time.Duration(expirationTime)*time.Second)
 	if err != nil {
 		log.Printf("Error creating jwt: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
@@ -85,20 +163,32 @@ func (cfg *ApiConfig) LoginHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if cookieMode {
+		err = cfg.setSessionCookies(w, token, refresh, time.Duration(expirationTime)*time.Second, 24*time.Hour)
+		if err != nil {
+			log.Printf("Error setting session cookies: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		token, refresh = "", ""
+	}
+
 	resObj := user_model{
-		Id:           usr.ID.String(),
-		CreatedAt:    usr.CreatedAt.String(),
-		UpdatedAt:    usr.UpdatedAt.String(),
-		Email:        usr.Email,
-		Token:        token,
-		RefreshToken: refresh,
-		IsChirpyRed:  usr.IsChirpyRed,
+		Id:            usr.ID.String(),
+		CreatedAt:     usr.CreatedAt.String(),
+		UpdatedAt:     usr.UpdatedAt.String(),
+		Email:         usr.Email,
+		Token:         token,
+		RefreshToken:  refresh,
+		IsChirpyRed:   isRed,
+		EmailVerified: usr.EmailVerifiedAt.Valid,
 	}
+	resObj.DeletionScheduledAt = nullTimeString(usr.DeletionScheduledAt)
 	respondWithJSON(w, http.StatusOK, resObj)
 }
 
 func (cfg *ApiConfig) RefreshHandler(w http.ResponseWriter, req *http.Request) {
-	token, err := auth.GetBearerToken(req.Header)
+	token, fromCookie, err := requestRefreshToken(req)
 	if err != nil {
 		log.Printf("Error fetching Bearer Token: %s", err)
 		respondWithError(w, http.StatusUnauthorized, err.Error())
@@ -118,12 +208,25 @@ func (cfg *ApiConfig) RefreshHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if tok.RevokedAt.Valid && tok.RevokedAt.Time.After(time.Now()) {
+	// Refresh tokens of OAuth clients can only be used at /oauth/token,
+	// otherwise they would turn into a token without scopes.
+	if tok.ClientID.Valid {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token belongs to an OAuth client")
+		return
+	}
+
+	if tok.RevokedAt.Valid {
 		log.Printf("Refresh revoked: %s", err)
 		respondWithError(w, http.StatusUnauthorized, "Refresh token revoked")
 		return
 	}
 
+	usr, err := cfg.Db.SelectUserById(req.Context(), tok.UserID)
+	if err != nil || usr.SuspendedAt.Valid {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token revoked")
+		return
+	}
+
 	err = cfg.Db.RevokeToken(req.Context(), tok.Token)
 	if err != nil {
 		log.Printf("Refresh revokation failed: %s", err)
@@ -131,22 +234,53 @@ func (cfg *ApiConfig) RefreshHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	jwt, err := auth.MakeJWT(tok.UserID, cfg.Jwt_secret, time.Hour)
+	jwt, err := auth.MakeJWT(tok.UserID, cfg.JwtKeys, time.Hour)
 	if err != nil {
 		log.Printf("New JWT creation failed: %s", err)
 		respondWithError(w, http.StatusUnauthorized, "Something went wrong")
 		return
 	}
 
+	// The used refresh token is revoked above, so a new one is handed out to
+	// keep the session going.
+	refresh, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating refresh: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	_, err = cfg.Db.CreateToken(req.Context(), database.CreateTokenParams{
+		UserID:    tok.UserID,
+		Token:     refresh,
+		ExpiresAt: time.Now().Add(24 * time.Hour),
+	})
+	if err != nil {
+		log.Printf("Error creating refresh: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if fromCookie {
+		err = cfg.setSessionCookies(w, jwt, refresh, time.Hour, 24*time.Hour)
+		if err != nil {
+			log.Printf("Error setting session cookies: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		respondWithoutBody(w, http.StatusNoContent)
+		return
+	}
+
 	jwts := struct {
-		Token string `json:"token"`
-	}{Token: jwt}
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}{Token: jwt, RefreshToken: refresh}
 
 	respondWithJSON(w, http.StatusOK, jwts)
 }
 
 func (cfg *ApiConfig) RevokeHandler(w http.ResponseWriter, req *http.Request) {
-	token, err := auth.GetBearerToken(req.Header)
+	token, fromCookie, err := requestRefreshToken(req)
 	if err != nil {
 		log.Printf("Error fetching Bearer Token: %s", err)
 		respondWithError(w, http.StatusUnauthorized, err.Error())
@@ -172,5 +306,41 @@ func (cfg *ApiConfig) RevokeHandler(w http.ResponseWriter, req *http.Request) {
 		respondWithError(w, http.StatusUnauthorized, "Refresh token expired")
 		return
 	}
+	if fromCookie {
+		cfg.clearSessionCookies(w)
+	}
 	respondWithoutBody(w, http.StatusNoContent)
 }
+
+// LogoutHandler ends the session of the calling access token right away
+// instead of waiting for it to expire.
+func (cfg *ApiConfig) LogoutHandler(w http.ResponseWriter, req *http.Request) {
+	principal := PrincipalFromContext(req.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	err := cfg.Revocations.Revoke(req.Context(), principal.TokenID, principal.ExpiresAt)
+	if err != nil {
+		log.Printf("Error revoking jwt: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if cookie, err := req.Cookie(refreshCookieName); err == nil {
+		err = cfg.Db.RevokeToken(req.Context(), cookie.Value)
+		if err != nil {
+			log.Printf("Refresh revokation failed: %s", err)
+		}
+		cfg.clearSessionCookies(w)
+	}
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+// invalidateSessions is called after security events like a password change.
+// It rejects all access tokens issued so far and revokes the refresh tokens.
+func (cfg *ApiConfig) invalidateSessions(ctx context.Context, userId uuid.UUID) error {
+	err := cfg.Revocations.InvalidateUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	return cfg.Db.RevokeUserTokens(ctx, userId)
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/DmitrijP/my-go-server/internal/stream"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	outboxNotifyChannel = "outbox_events"
+	streamBufferSize    = 256
+	streamHeartbeat     = 25 * time.Second
+	// A client resuming with Last-Event-ID gets the events of the last 24
+	// hours, at most streamResumeMax of them. When the cap cuts the replay
+	// short the client is sent a resync event and reloads GET /api/chirps.
+	streamResumeMax = 1000
+)
+
+func isChirpEvent(eventType string) bool {
+	return eventType == "chirp.created" || eventType == "chirp.deleted"
+}
+
+// authorFilter reads the author_id query parameter. Like on GET /api/chirps
+// a missing or unparsable id means no filter.
+func authorFilter(req *http.Request) uuid.NullUUID {
+	id, err := uuid.Parse(req.URL.Query().Get("author_id"))
+	return uuid.NullUUID{UUID: id, Valid: err == nil}
+}
+
+// RunEventStream publishes new outbox events to cfg.Events until ctx is done.
+// Every replica listens for the NOTIFY sent by the outbox_events trigger, so
+// clients get the events no matter which replica wrote them. The periodic
+// poll covers notifications lost while the listener reconnects.
+func (cfg *ApiConfig) RunEventStream(ctx context.Context, dbURL string) {
+	listener := pq.NewListener(dbURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Event listener: %s", err)
+		}
+	})
+	defer listener.Close()
+	err := listener.Listen(outboxNotifyChannel)
+	if err != nil {
+		log.Printf("Error listening for outbox events: %s", err)
+	}
+
+	// Events from before the start are not published, clients read them
+	// from the database with their Last-Event-ID.
+	lastId, err := cfg.Db.GetLatestOutboxEventID(ctx)
+	for err != nil {
+		log.Printf("Error selecting latest outbox event: %s", err)
+		select {
+		case <-ctx.Done():
+			cfg.Events.Close()
+			return
+		case <-time.After(5 * time.Second):
+		}
+		lastId, err = cfg.Db.GetLatestOutboxEventID(ctx)
+	}
+	pub := &outboxPublisher{settledId: lastId, published: map[int64]bool{}}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			cfg.Events.Close()
+			return
+		case <-listener.Notify:
+		case <-ticker.C:
+		}
+		cfg.publishOutboxEvents(ctx, pub)
+	}
+}
+
+// outboxPublisher tracks what RunEventStream has published. Outbox ids are
+// taken before the inserting transaction commits, so a row with a lower id
+// can show up after one with a higher id. Rows are read again until they are
+// settled, and the ids published in the meantime are kept so none is sent
+// twice.
+type outboxPublisher struct {
+	settledId int64
+	published map[int64]bool
+}
+
+func (cfg *ApiConfig) publishOutboxEvents(ctx context.Context, pub *outboxPublisher) {
+	afterId := pub.settledId
+	settled := true
+	for {
+		events, err := cfg.Db.ListOutboxEventsSince(ctx, database.ListOutboxEventsSinceParams{ID: afterId, Limit: 500})
+		if err != nil {
+			log.Printf("Error selecting outbox events: %s", err)
+			return
+		}
+		for _, event := range events {
+			id := event.OutboxEvent.ID
+			if !pub.published[id] {
+				cfg.Events.Publish(toStreamEvent(event.OutboxEvent))
+				pub.published[id] = true
+			}
+			// The cursor only moves over a run of settled rows, a late
+			// row can still appear behind a younger one.
+			settled = settled && event.Settled
+			if settled {
+				pub.settledId = id
+				delete(pub.published, id)
+			}
+			afterId = id
+		}
+		if len(events) < 500 {
+			return
+		}
+	}
+}
+
+func toStreamEvent(event database.OutboxEvent) stream.Event {
+	return stream.Event{ID: event.ID, Type: event.Type, UserID: event.UserID, Data: event.Payload}
+}
+
+// ChirpStreamHandler sends chirp.created and chirp.deleted events as
+// Server-Sent Events. Event ids are outbox ids, so a client reconnecting
+// with Last-Event-ID (or ?last_event_id=) first gets what it missed.
+func (cfg *ApiConfig) ChirpStreamHandler(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+	author := authorFilter(req)
+
+	lastEvent := req.Header.Get("Last-Event-ID")
+	if lastEvent == "" {
+		lastEvent = req.URL.Query().Get("last_event_id")
+	}
+	var lastId int64
+	if lastEvent != "" {
+		id, err := strconv.ParseInt(lastEvent, 10, 64)
+		if err != nil || id < 0 {
+			w.Header().Set("Content-Type", "application/json")
+			respondWithError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		lastId = id
+	}
+
+	// Subscribed before the backlog is read, so nothing falls in between.
+	// Events that show up in both are skipped by their id. Ids do not arrive
+	// in order, so the replayed ones are remembered instead of comparing
+	// against the last id.
+	sub := cfg.Events.Subscribe(streamBufferSize)
+	defer sub.Unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	replayed := map[int64]bool{}
+	if lastEvent != "" {
+		events, err := cfg.Db.ListChirpEventsAfter(req.Context(), database.ListChirpEventsAfterParams{
+			AfterID:   lastId,
+			AuthorID:  author,
+			MaxEvents: streamResumeMax,
+		})
+		if err != nil {
+			log.Printf("Error selecting chirp events: %s", err)
+			return
+		}
+		for _, event := range events {
+			writeStreamEvent(w, toStreamEvent(event))
+			replayed[event.ID] = true
+		}
+		if len(events) == streamResumeMax {
+			fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-sub.Done():
+			// Too slow to keep up or shutting down, the client reconnects
+			// with its last event id.
+			return
+		case <-heartbeat.C:
+			// Events read in the backlog have been published long before
+			// the first heartbeat.
+			replayed = nil
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case event := <-sub.Events():
+			if replayed[event.ID] || !isChirpEvent(event.Type) {
+				continue
+			}
+			if author.Valid && event.UserID != author {
+				continue
+			}
+			writeStreamEvent(w, event)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, event stream.Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
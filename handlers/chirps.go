@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"regexp"
+	"slices"
 	"strings"
 
-	"github.com/DmitrijP/my-go-server/internal/auth"
 	"github.com/DmitrijP/my-go-server/internal/database"
 	"github.com/google/uuid"
 )
@@ -17,31 +19,43 @@ type chirp_model struct {
 	UpdatedAt string `json:"updated_at"`
 	Body      string `json:"body"`
 	UserId    string `json:"user_id"`
+	// ReplyTo is the chirp this one answers, null for a new thread.
+	ReplyTo *string `json:"reply_to"`
 }
 
 type chirp_create struct {
-	Body string `json:"body"`
+	Body    string     `json:"body"`
+	ReplyTo *uuid.UUID `json:"reply_to"`
 }
 
-func (cfg *ApiConfig) ChirpsHandler(w http.ResponseWriter, req *http.Request) {
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		log.Printf("Error fetching Bearer Token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
+func nullUUIDString(id uuid.NullUUID) *string {
+	if !id.Valid {
+		return nil
 	}
+	s := id.UUID.String()
+	return &s
+}
 
-	user_id, err := auth.ValidateJWT(token, cfg.Jwt_secret)
-	if err != nil {
-		log.Printf("Error validating jwt: %s", err)
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
+func (cfg *ApiConfig) ChirpsHandler(w http.ResponseWriter, req *http.Request) {
+	user_id := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	if cfg.RequireVerifiedEmail {
+		usr, err := cfg.Db.SelectUserById(req.Context(), user_id)
+		if err != nil {
+			log.Printf("Error selecting usr: %s", err)
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !usr.EmailVerifiedAt.Valid {
+			respondWithError(w, http.StatusForbidden, "Email address not verified")
+			return
+		}
 	}
 
 	decoder := json.NewDecoder(req.Body)
 	params := chirp_create{}
-	err = decoder.Decode(&params)
-	w.Header().Set("Content-Type", "application/json")
+	err := decoder.Decode(&params)
 
 	if err != nil {
 		log.Printf("Error decoding parameters: %s", err)
@@ -49,23 +63,63 @@ func (cfg *ApiConfig) ChirpsHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if len(params.Body) > 140 {
-		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
+	lowerBody, err := prepareChirp(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	lowerBody := cleanChirpText(params.Body)
-
 	var c = database.CreateChirpParams{Body: lowerBody, UserID: user_id}
+	var parentAuthor uuid.NullUUID
+	if params.ReplyTo != nil {
+		parent, err := cfg.Db.GetOneChirp(req.Context(), *params.ReplyTo)
+		if err != nil {
+			respondWithValidationErrors(w, map[string][]string{"reply_to": {"chirp not found"}})
+			return
+		}
+		c.ReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		parentAuthor = uuid.NullUUID{UUID: parent.UserID, Valid: true}
+	}
 
-	chirp, err := cfg.Db.CreateChirp(req.Context(), c)
+	// The chirp and its user.mentioned events are written together, so a
+	// mention is never announced for a chirp that does not exist.
+	var chirp database.Chirp
+	var mentioned []uuid.NullUUID
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		var err error
+		chirp, err = q.CreateChirp(req.Context(), c)
+		if err != nil {
+			return err
+		}
+		usernames := mentionedUsernames(chirp.Body)
+		if len(usernames) == 0 {
+			return nil
+		}
+		mentioned, err = q.CreateMentionEvents(req.Context(), database.CreateMentionEventsParams{Usernames: usernames, ChirpID: chirp.ID})
+		return err
+	})
 	if err != nil {
 		log.Printf("Error saving chirp: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	resObj := chirp_model{Id: chirp.ID.String(), CreatedAt: chirp.CreatedAt.String(), UpdatedAt: chirp.UpdatedAt.String(), Body: chirp.Body, UserId: chirp.UserID.String()}
+	// Replies are grouped under the chirp they answer, mentions under the
+	// chirp that mentions.
+	if parentAuthor.Valid {
+		err = cfg.notify(req.Context(), parentAuthor.UUID, user_id, notificationReply, c.ReplyTo)
+		if err != nil {
+			log.Printf("Error creating reply notification: %s", err)
+		}
+	}
+	for _, recipient := range mentioned {
+		err = cfg.notify(req.Context(), recipient.UUID, user_id, notificationMention, uuid.NullUUID{UUID: chirp.ID, Valid: true})
+		if err != nil {
+			log.Printf("Error creating mention notification: %s", err)
+		}
+	}
+
+	resObj := chirp_model{Id: chirp.ID.String(), CreatedAt: chirp.CreatedAt.String(), UpdatedAt: chirp.UpdatedAt.String(), Body: chirp.Body, UserId: chirp.UserID.String(), ReplyTo: nullUUIDString(chirp.ReplyTo)}
 	respondWithJSON(w, http.StatusCreated, resObj)
 }
 
@@ -77,14 +131,13 @@ func (cfg *ApiConfig) GetAllChirpsHandler(w http.ResponseWriter, req *http.Reque
 		sortDir = "desc"
 	}
 
-	s := req.URL.Query().Get("author_id")
-	qId, err := uuid.Parse(s)
+	author := authorFilter(req)
 	var chirps []database.Chirp
-	if s != "" && err != nil {
+	if author.Valid {
 		if sortDir == "asc" {
-			chirps, _ = cfg.Db.GetAllChirpsByAuthor(req.Context(), qId)
+			chirps, _ = cfg.Db.GetAllChirpsByAuthor(req.Context(), author.UUID)
 		} else {
-			chirps, _ = cfg.Db.GetAllChirpsByAuthorDesc(req.Context(), qId)
+			chirps, _ = cfg.Db.GetAllChirpsByAuthorDesc(req.Context(), author.UUID)
 		}
 	} else {
 		if sortDir == "asc" {
@@ -103,6 +156,7 @@ func (cfg *ApiConfig) GetAllChirpsHandler(w http.ResponseWriter, req *http.Reque
 				UpdatedAt: chirp.UpdatedAt.String(),
 				Body:      chirp.Body,
 				UserId:    chirp.UserID.String(),
+				ReplyTo:   nullUUIDString(chirp.ReplyTo),
 			})
 	}
 
@@ -130,24 +184,13 @@ func (cfg *ApiConfig) GetOneChirpsHandler(w http.ResponseWriter, req *http.Reque
 		UpdatedAt: chirp.UpdatedAt.String(),
 		Body:      chirp.Body,
 		UserId:    chirp.UserID.String(),
+		ReplyTo:   nullUUIDString(chirp.ReplyTo),
 	}
 	respondWithJSON(w, http.StatusOK, chirp_model)
 }
 
 func (cfg *ApiConfig) DeleteChirpHandler(w http.ResponseWriter, req *http.Request) {
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		log.Printf("Error fetching Bearer Token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
-
-	id, err := auth.ValidateJWT(token, cfg.Jwt_secret)
-	if err != nil {
-		log.Printf("Error validating jwt: %s", err)
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
+	id := PrincipalFromContext(req.Context()).UserID
 
 	w.Header().Set("Content-Type", "application/json")
 	chirpId := req.PathValue("chirpID")
@@ -178,6 +221,67 @@ func (cfg *ApiConfig) DeleteChirpHandler(w http.ResponseWriter, req *http.Reques
 	respondWithoutBody(w, http.StatusNoContent)
 }
 
+// LikeChirpHandler likes a chirp for the caller and notifies its author.
+// Liking a chirp twice changes nothing.
+func (cfg *ApiConfig) LikeChirpHandler(w http.ResponseWriter, req *http.Request) {
+	id := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	chirpUuid, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	chirp, err := cfg.Db.GetOneChirp(req.Context(), chirpUuid)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	liked, err := cfg.Db.LikeChirp(req.Context(), database.LikeChirpParams{ChirpID: chirp.ID, UserID: id})
+	if err != nil {
+		log.Printf("Error liking chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if liked > 0 {
+		err = cfg.notify(req.Context(), chirp.UserID, id, notificationLike, uuid.NullUUID{UUID: chirp.ID, Valid: true})
+		if err != nil {
+			log.Printf("Error creating like notification: %s", err)
+		}
+	}
+
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) UnlikeChirpHandler(w http.ResponseWriter, req *http.Request) {
+	id := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	chirpUuid, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	_, err = cfg.Db.UnlikeChirp(req.Context(), database.UnlikeChirpParams{ChirpID: chirpUuid, UserID: id})
+	if err != nil {
+		log.Printf("Error unliking chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+// prepareChirp validates a chirp body and filters it. Every way of creating
+// chirps goes through it.
+func prepareChirp(body string) (string, error) {
+	if len(body) > 140 {
+		return "", errors.New("Chirp is too long")
+	}
+	return cleanChirpText(body), nil
+}
+
 var forbiddenWords = []string{
 	"kerfuffle",
 	"sharbert",
@@ -197,3 +301,30 @@ func cleanChirpText(input string) string {
 	input = strings.Join(words, " ")
 	return input
 }
+
+var (
+	usernamePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+	mentionPattern  = regexp.MustCompile(`(?:^|[^a-z0-9_])@([a-z0-9_]{3,30})\b`)
+)
+
+// maxMentions caps the users one chirp can mention.
+const maxMentions = 10
+
+func validUsername(username string) bool {
+	return usernamePattern.MatchString(username)
+}
+
+// mentionedUsernames returns the distinct @usernames in a chirp body, at
+// most maxMentions of them.
+func mentionedUsernames(body string) []string {
+	var usernames []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(strings.ToLower(body), -1) {
+		if !slices.Contains(usernames, match[1]) {
+			usernames = append(usernames, match[1])
+		}
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+	return usernames
+}
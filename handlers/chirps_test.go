@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMentionedUsernames(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{"hello world", nil},
+		{"@alice hi", []string{"alice"}},
+		{"hi @Alice and @bob_2, @alice again", []string{"alice", "bob_2"}},
+		{"mail me at me@example.com", nil},
+		{"@ab is too short", nil},
+		{"@abcdefghijklmnopqrstuvwxyz12345 is too long", nil},
+		{"@aa1 @aa2 @aa3 @aa4 @aa5 @aa6 @aa7 @aa8 @aa9 @ab1 @ab2", []string{"aa1", "aa2", "aa3", "aa4", "aa5", "aa6", "aa7", "aa8", "aa9", "ab1"}},
+	}
+	for _, tt := range tests {
+		if got := mentionedUsernames(tt.body); !slices.Equal(got, tt.want) {
+			t.Errorf("mentionedUsernames(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
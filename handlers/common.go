@@ -1,14 +1,47 @@
 package handlers
 
 import (
+	"database/sql"
+	"net/http"
+	"net/netip"
 	"sync/atomic"
+	"time"
 
+	"github.com/DmitrijP/my-go-server/internal/auth"
 	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/DmitrijP/my-go-server/internal/lockout"
+	"github.com/DmitrijP/my-go-server/internal/mail"
+	"github.com/DmitrijP/my-go-server/internal/oidc"
+	"github.com/DmitrijP/my-go-server/internal/revocation"
+	"github.com/DmitrijP/my-go-server/internal/stream"
+	"github.com/DmitrijP/my-go-server/internal/webauthn"
+	"github.com/DmitrijP/my-go-server/internal/webhook"
 )
 
 type ApiConfig struct {
-	Jwt_secret     string
-	FileserverHits atomic.Int32
-	Db             database.Queries
-	PolkaKey       string
+	JwtKeys              *auth.KeySet
+	FileserverHits       atomic.Int32
+	Db                   database.Queries
+	SqlDB                *sql.DB
+	PolkaKey             string
+	PolkaAllowAPIKey     bool
+	PolkaVerifier        *webhook.Verifier
+	Mailer               mail.Mailer
+	BaseURL              string
+	RequireVerifiedEmail bool
+	PasswordPolicy       auth.PasswordPolicy
+	LoginLimiter         *lockout.Limiter
+	MailLimiter          *lockout.Limiter
+	CeremonyLimiter      *lockout.Limiter
+	TrustedProxies       []netip.Prefix
+	OIDC                 *oidc.Provider
+	WebAuthn             *webauthn.RelyingParty
+	Revocations          *revocation.List
+	AccountDeletionGrace time.Duration
+	ExportDir            string
+	ExportSigningKey     []byte
+	ImportDir            string
+	WebhookClient        *http.Client
+	WebhookAllowInsecure bool
+	Events               *stream.Broker
 }
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/DmitrijP/my-go-server/internal/mail"
+)
+
+const emailVerificationTTL = 48 * time.Hour
+
+type email_verification_confirm struct {
+	Token string `json:"token"`
+}
+
+func (cfg *ApiConfig) EmailVerificationConfirmHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(req.Body)
+	params := email_verification_confirm{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	tok, err := cfg.Db.GetEmailVerificationToken(req.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		log.Printf("Error selecting verification token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Verification link invalid or expired")
+		return
+	}
+
+	used, err := cfg.Db.UseEmailVerificationToken(req.Context(), tok.TokenHash)
+	if err != nil || used != 1 {
+		log.Printf("Verification token already used or expired: %v", err)
+		respondWithError(w, http.StatusBadRequest, "Verification link invalid or expired")
+		return
+	}
+
+	// The token only verifies the address it was sent to. If the user changed
+	// their email in the meantime nothing is updated.
+	verified, err := cfg.Db.MarkEmailVerified(req.Context(), database.MarkEmailVerifiedParams{ID: tok.UserID, Email: tok.Email})
+	if err != nil || verified != 1 {
+		log.Printf("Error marking email verified: %v", err)
+		respondWithError(w, http.StatusBadRequest, "Verification link invalid or expired")
+		return
+	}
+
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) EmailVerificationResendHandler(w http.ResponseWriter, req *http.Request) {
+	id := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	usr, err := cfg.Db.SelectUserById(req.Context(), id)
+	if err != nil {
+		log.Printf("Error selecting usr: %s", err)
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if usr.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Email already verified")
+		return
+	}
+
+	err = cfg.sendEmailVerification(req.Context(), usr)
+	if err != nil {
+		log.Printf("Error sending verification: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	respondWithoutBody(w, http.StatusAccepted)
+}
+
+func (cfg *ApiConfig) sendEmailVerification(ctx context.Context, usr database.User) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	tkParams := database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+		Email:     usr.Email,
+		UserID:    usr.ID,
+	}
+	_, err = cfg.Db.CreateEmailVerificationToken(ctx, tkParams)
+	if err != nil {
+		return err
+	}
+
+	cfg.sendMail(mail.Message{
+		To:      usr.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Please confirm that this is your email address by opening the link below:\n\n"+
+			"%s/app/verify-email.html?token=%s\n\nThe link is valid for %d hours.",
+			cfg.BaseURL, token, int(emailVerificationTTL.Hours())),
+	})
+	return nil
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	jobTypeExport = "export"
+	// Finished exports are kept this long, download links are valid for
+	// exportURLTTL but never beyond that.
+	exportRetention = 7 * 24 * time.Hour
+	exportURLTTL    = time.Hour
+)
+
+type export_session struct {
+	CreatedAt string   `json:"created_at"`
+	ExpiresAt string   `json:"expires_at"`
+	RevokedAt *string  `json:"revoked_at"`
+	ClientId  *string  `json:"client_id"`
+	Scopes    []string `json:"scopes"`
+}
+
+type export_result struct {
+	FileSize  int64  `json:"file_size"`
+	Chirps    int    `json:"chirps"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// ExportHandler starts building a ZIP of all data of the calling user. The
+// work happens in RunJobs, the job can be polled at /api/jobs/{jobID}.
+func (cfg *ApiConfig) ExportHandler(w http.ResponseWriter, req *http.Request) {
+	principal := PrincipalFromContext(req.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if !cfg.exportsEnabled() {
+		respondWithError(w, http.StatusServiceUnavailable, "Data exports are not configured")
+		return
+	}
+
+	activeParams := database.GetActiveJobParams{UserID: principal.UserID, Type: jobTypeExport}
+	job, err := cfg.Db.GetActiveJob(req.Context(), activeParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		job, err = cfg.Db.CreateJob(req.Context(), database.CreateJobParams{
+			Type:    jobTypeExport,
+			Payload: json.RawMessage(`{}`),
+			UserID:  principal.UserID,
+		})
+		// A concurrent request queued the export first.
+		if isUniqueViolation(err) {
+			job, err = cfg.Db.GetActiveJob(req.Context(), activeParams)
+		}
+	}
+	if err != nil {
+		log.Printf("Error creating export job: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID.String())
+	respondWithJSON(w, http.StatusAccepted, cfg.toJobModel(job, true))
+}
+
+// ExportDownloadHandler serves a finished export. It is not authenticated,
+// the signed link returned with the job is the authorization.
+func (cfg *ApiConfig) ExportDownloadHandler(w http.ResponseWriter, req *http.Request) {
+	if !cfg.exportsEnabled() {
+		w.Header().Set("Content-Type", "application/json")
+		respondWithError(w, http.StatusServiceUnavailable, "Data exports are not configured")
+		return
+	}
+	jobUuid, err := uuid.Parse(req.PathValue("jobID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Export not found")
+		return
+	}
+	expires, err := strconv.ParseInt(req.URL.Query().Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		respondWithError(w, http.StatusForbidden, "Download link expired")
+		return
+	}
+	sig, err := hex.DecodeString(req.URL.Query().Get("signature"))
+	if err != nil || !hmac.Equal(sig, cfg.signExport(jobUuid, expires)) {
+		respondWithError(w, http.StatusForbidden, "Download link invalid")
+		return
+	}
+
+	f, err := os.Open(cfg.exportPath(jobUuid))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Export not found")
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		log.Printf("Error reading export: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.zip"`)
+	http.ServeContent(w, req, "chirpy-export.zip", stat.ModTime(), f)
+}
+
+func (cfg *ApiConfig) runExportJob(ctx context.Context, job database.Job) (any, error) {
+	usr, err := cfg.Db.SelectUserById(ctx, job.UserID)
+	if err != nil {
+		return nil, err
+	}
+	chirps, err := cfg.Db.GetAllChirpsByAuthor(ctx, job.UserID)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := cfg.Db.ListUserTokens(ctx, job.UserID)
+	if err != nil {
+		return nil, err
+	}
+	isRed, err := cfg.isChirpyRed(ctx, job.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(cfg.ExportDir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	// Written under a temporary name, so a crash never leaves a half
+	// written export behind a valid link.
+	path := cfg.exportPath(job.ID)
+	f, err := os.CreateTemp(cfg.ExportDir, job.ID.String()+"-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	profile := user_create_response{
+		Id:            usr.ID.String(),
+		CreatedAt:     usr.CreatedAt.String(),
+		UpdatedAt:     usr.UpdatedAt.String(),
+		Email:         usr.Email,
+		IsChirpyRed:   isRed,
+		EmailVerified: usr.EmailVerifiedAt.Valid,
+		Username:      usernameOf(usr),
+	}
+	err = writeZipJSON(zw, "profile.json", profile)
+	if err != nil {
+		return nil, err
+	}
+
+	chirp_models := []chirp_model{}
+	for _, chirp := range chirps {
+		chirp_models = append(chirp_models, chirp_model{
+			Id:        chirp.ID.String(),
+			CreatedAt: chirp.CreatedAt.Format(time.RFC3339Nano),
+			UpdatedAt: chirp.UpdatedAt.Format(time.RFC3339Nano),
+			Body:      chirp.Body,
+			UserId:    chirp.UserID.String(),
+			ReplyTo:   nullUUIDString(chirp.ReplyTo),
+		})
+	}
+	err = writeZipJSON(zw, "chirps.json", chirp_models)
+	if err != nil {
+		return nil, err
+	}
+	err = writeChirpsCSV(zw, chirp_models)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []export_session{}
+	for _, tok := range tokens {
+		s := export_session{
+			CreatedAt: tok.CreatedAt.String(),
+			ExpiresAt: tok.ExpiresAt.String(),
+			RevokedAt: nullTimeString(tok.RevokedAt),
+			Scopes:    auth.ParseScopes(tok.Scopes),
+		}
+		if tok.ClientID.Valid {
+			s.ClientId = &tok.ClientID.String
+		}
+		sessions = append(sessions, s)
+	}
+	err = writeZipJSON(zw, "sessions.json", sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return nil, err
+	}
+
+	return export_result{
+		FileSize:  stat.Size(),
+		Chirps:    len(chirp_models),
+		ExpiresAt: time.Now().Add(exportRetention).String(),
+	}, nil
+}
+
+func writeZipJSON(zw *zip.Writer, name string, v any) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeChirpsCSV uses the columns the bulk import accepts, so an export can
+// be imported again.
+func writeChirpsCSV(zw *zip.Writer, chirps []chirp_model) error {
+	w, err := zw.Create("chirps.csv")
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	err = cw.Write([]string{"id", "created_at", "body"})
+	if err != nil {
+		return err
+	}
+	for _, chirp := range chirps {
+		err = cw.Write([]string{chirp.Id, chirp.CreatedAt, chirp.Body})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (cfg *ApiConfig) exportPath(jobId uuid.UUID) string {
+	return filepath.Join(cfg.ExportDir, jobId.String()+".zip")
+}
+
+// exportsEnabled tells if EXPORT_SIGNING_KEY is set. Without it no download
+// link can be signed.
+func (cfg *ApiConfig) exportsEnabled() bool {
+	return len(cfg.ExportSigningKey) > 0
+}
+
+func (cfg *ApiConfig) signExport(jobId uuid.UUID, expires int64) []byte {
+	mac := hmac.New(sha256.New, cfg.ExportSigningKey)
+	io.WriteString(mac, fmt.Sprintf("%s:%d", jobId, expires))
+	return mac.Sum(nil)
+}
+
+func (cfg *ApiConfig) exportDownloadURL(job database.Job) string {
+	if !job.FinishedAt.Valid || !cfg.exportsEnabled() {
+		return ""
+	}
+	expires := time.Now().Add(exportURLTTL)
+	if end := job.FinishedAt.Time.Add(exportRetention); end.Before(expires) {
+		expires = end
+	}
+	if expires.Before(time.Now()) {
+		return ""
+	}
+	return fmt.Sprintf("%s/api/exports/%s?expires=%d&signature=%s",
+		cfg.BaseURL, job.ID, expires.Unix(), hex.EncodeToString(cfg.signExport(job.ID, expires.Unix())))
+}
+
+// cleanupFiles removes files older than maxAge, finished exports past their
+// retention as well as files left behind by interrupted jobs.
+func cleanupFiles(dir string, maxAge time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Error reading %s: %s", dir, err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		err = os.Remove(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			log.Printf("Error removing %s: %s", entry.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// fakeResult is what a fakeDB answers to one query. Columns and rows are
+// returned to the scan of the generated query code as they are.
+type fakeResult struct {
+	columns []string
+	rows    [][]driver.Value
+	err     error
+}
+
+// fakeDB stands in for PostgreSQL in handler tests. Queries are matched by
+// their sqlc name, queries without a handler return no rows.
+type fakeDB struct {
+	mu       sync.Mutex
+	handlers map[string]func(args []driver.Value) fakeResult
+}
+
+func (f *fakeDB) on(name string, fn func(args []driver.Value) fakeResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[name] = fn
+}
+
+func (f *fakeDB) answer(query string, args []driver.Value) fakeResult {
+	name := ""
+	if rest, ok := strings.CutPrefix(query, "-- name: "); ok {
+		name, _, _ = strings.Cut(rest, " ")
+	}
+	f.mu.Lock()
+	fn := f.handlers[name]
+	f.mu.Unlock()
+	if fn == nil {
+		return fakeResult{}
+	}
+	return fn(args)
+}
+
+var fakeDBs sync.Map
+var fakeDBCount atomic.Int64
+
+// newFakeDB returns the fake and queries running against it.
+func newFakeDB(t *testing.T) (*fakeDB, database.Queries) {
+	t.Helper()
+	f := &fakeDB{handlers: map[string]func(args []driver.Value) fakeResult{}}
+	name := fmt.Sprintf("fake-%d", fakeDBCount.Add(1))
+	fakeDBs.Store(name, f)
+	db, err := sql.Open("handlers-fake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fakeDBs.Delete(name)
+	})
+	return f, *database.New(db)
+}
+
+func init() {
+	sql.Register("handlers-fake", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	f, ok := fakeDBs.Load(name)
+	if !ok {
+		return nil, errors.New("unknown fake db " + name)
+	}
+	return &fakeConn{db: f.(*fakeDB)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	res := s.db.answer(s.query, args)
+	if res.err != nil {
+		return nil, res.err
+	}
+	return driver.RowsAffected(len(res.rows)), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	res := s.db.answer(s.query, args)
+	if res.err != nil {
+		return nil, res.err
+	}
+	return &fakeRows{columns: res.columns, rows: res.rows}, nil
+}
+
+// CheckNamedValue converts driver.Valuer arguments such as uuid.UUID and
+// accepts everything else, pq.Array included.
+func (s *fakeStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok := nv.Value.(driver.Valuer); ok {
+		val, err := v.Value()
+		if err != nil {
+			return err
+		}
+		nv.Value = val
+	}
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var userColumns = []string{"id", "created_at", "updated_at", "email", "hashed_password", "email_verified_at", "role", "tokens_valid_after", "suspended_at", "deletion_scheduled_at", "dm_permission", "username"}
+
+// userRow answers SelectUserById for an active user.
+func userRow(id uuid.UUID) fakeResult {
+	now := time.Now()
+	return fakeResult{
+		columns: userColumns,
+		rows:    [][]driver.Value{{id.String(), now, now, id.String() + "@example.com", "unset", now, "user", nil, nil, nil, "everyone", nil}},
+	}
+}
+
+// noRevocations is a revocation store without revoked tokens.
+type noRevocations struct{}
+
+func (noRevocations) InvalidateTokens(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	return nil
+}
+func (noRevocations) IsRevoked(ctx context.Context, tokenID string) (bool, error) { return false, nil }
+func (noRevocations) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	return nil
+}
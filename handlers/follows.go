@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// FollowUserHandler lets the caller follow another user. A new follow is
+// written to the outbox as follow.created and notifies the followed user;
+// following someone twice changes nothing.
+func (cfg *ApiConfig) FollowUserHandler(w http.ResponseWriter, req *http.Request) {
+	id := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	userUuid, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if userUuid == id {
+		respondWithError(w, http.StatusBadRequest, "You cannot follow yourself")
+		return
+	}
+	_, err = cfg.Db.SelectUserById(req.Context(), userUuid)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	followed, err := cfg.Db.FollowUser(req.Context(), database.FollowUserParams{FollowerID: id, FolloweeID: userUuid})
+	if err != nil {
+		log.Printf("Error following user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if followed > 0 {
+		// All follows of a user form one group, they have no target.
+		err = cfg.notify(req.Context(), userUuid, id, notificationFollow, uuid.NullUUID{})
+		if err != nil {
+			log.Printf("Error creating follow notification: %s", err)
+		}
+	}
+
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) UnfollowUserHandler(w http.ResponseWriter, req *http.Request) {
+	id := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	userUuid, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	_, err = cfg.Db.UnfollowUser(req.Context(), database.UnfollowUserParams{FollowerID: id, FolloweeID: userUuid})
+	if err != nil {
+		log.Printf("Error unfollowing user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+// BlockUserHandler blocks another user. Blocked users cannot start a
+// conversation with the caller or send messages to a conversation the caller
+// is in, and the caller cannot start one with them.
+func (cfg *ApiConfig) BlockUserHandler(w http.ResponseWriter, req *http.Request) {
+	id := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	userUuid, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if userUuid == id {
+		respondWithError(w, http.StatusBadRequest, "You cannot block yourself")
+		return
+	}
+	_, err = cfg.Db.SelectUserById(req.Context(), userUuid)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	_, err = cfg.Db.BlockUser(req.Context(), database.BlockUserParams{BlockerID: id, BlockedID: userUuid})
+	if err != nil {
+		log.Printf("Error blocking user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) UnblockUserHandler(w http.ResponseWriter, req *http.Request) {
+	id := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	userUuid, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	_, err = cfg.Db.UnblockUser(req.Context(), database.UnblockUserParams{BlockerID: id, BlockedID: userUuid})
+	if err != nil {
+		log.Printf("Error unblocking user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithoutBody(w, http.StatusNoContent)
+}
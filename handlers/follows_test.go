@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestFollowNotifiesOnlyNewFollows(t *testing.T) {
+	follower, followee := uuid.New(), uuid.New()
+	fake, db := newFakeDB(t)
+	fake.on("SelectUserById", func(args []driver.Value) fakeResult {
+		return userRow(followee)
+	})
+	alreadyFollowing := false
+	fake.on("FollowUser", func(args []driver.Value) fakeResult {
+		if alreadyFollowing {
+			return fakeResult{}
+		}
+		alreadyFollowing = true
+		return fakeResult{rows: [][]driver.Value{{}}}
+	})
+	var notified [][]driver.Value
+	fake.on("CreateNotification", func(args []driver.Value) fakeResult {
+		notified = append(notified, args)
+		return fakeResult{rows: [][]driver.Value{{}}}
+	})
+	cfg := &ApiConfig{Db: db}
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/api/users/"+followee.String()+"/follow", nil)
+		req.SetPathValue("userID", followee.String())
+		req = req.WithContext(withPrincipal(req.Context(), Principal{UserID: follower}))
+		rec := httptest.NewRecorder()
+		cfg.FollowUserHandler(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	if len(notified) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(notified))
+	}
+	args := notified[0]
+	if args[0] != followee.String() || args[1] != follower.String() || args[2] != notificationFollow || args[3] != nil {
+		t.Errorf("notification args = %v", args)
+	}
+}
@@ -1,15 +1,29 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"net/mail"
+	"net/netip"
+	"strings"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/lib/pq"
 )
 
 type http_error struct {
 	Error string `json:"error"`
 }
 
+type validation_error struct {
+	Error  string              `json:"error"`
+	Fields map[string][]string `json:"fields"`
+}
+
 func respondWithError(w http.ResponseWriter, code int, msg string) {
 	errorObj := http_error{Error: msg}
 	dat, err := json.Marshal(errorObj)
@@ -36,3 +50,75 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 func respondWithoutBody(w http.ResponseWriter, code int) {
 	w.WriteHeader(code)
 }
+
+func respondWithValidationErrors(w http.ResponseWriter, fields map[string][]string) {
+	respondWithJSON(w, http.StatusUnprocessableEntity, validation_error{Error: "Validation failed", Fields: fields})
+}
+
+// validEmail accepts a bare address like alice@example.com. Display names
+// and other RFC 5322 forms are rejected, mails are only sent to the address.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// clientIP returns the address of the client. X-Forwarded-For is only used
+// when the request comes from a trusted proxy; the list is then walked from
+// the right and the first address that is not a trusted proxy wins, as the
+// left part of the header is controlled by the client.
+func clientIP(req *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	if !isTrustedProxy(host, trustedProxies) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop, trustedProxies) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func isTrustedProxy(ip string, trustedProxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// withTx runs fn with queries bound to a single transaction. It commits when
+// fn succeeds and rolls back otherwise.
+func (cfg *ApiConfig) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.SqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = fn(cfg.Db.WithTx(tx))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
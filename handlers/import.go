@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	jobTypeImport = "import"
+	maxImportSize = 20 << 20
+	// Only this many row errors are kept in the job result, the counters
+	// still cover all rows.
+	maxImportErrors     = 100
+	importProgressEvery = 100
+	// An upload is at most maxImportSize, but a ZIP can unpack to far more.
+	// Files are read up to maxImportUnpacked bytes and maxImportRows rows.
+	maxImportUnpacked = 50 << 20
+	maxImportRows     = 100000
+)
+
+var (
+	errImportTooLarge    = fmt.Errorf("file is larger than %d MB", maxImportUnpacked>>20)
+	errImportTooManyRows = fmt.Errorf("file has more than %d chirps", maxImportRows)
+)
+
+// Timestamps of other platforms come in many shapes, these are tried in order.
+var importTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+type import_payload struct {
+	File   string `json:"file"`
+	Format string `json:"format"`
+}
+
+type import_row struct {
+	CreatedAt string `json:"created_at"`
+	Timestamp string `json:"timestamp"`
+	Body      string `json:"body"`
+}
+
+type import_row_error struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type import_result struct {
+	Total    int                `json:"total"`
+	Imported int                `json:"imported"`
+	Skipped  int                `json:"skipped"`
+	Failed   int                `json:"failed"`
+	Errors   []import_row_error `json:"errors"`
+}
+
+// ImportChirpsHandler takes an export ZIP, a CSV with timestamp and body
+// columns or a JSON array of chirps and queues it for import. Progress and
+// row errors are reported on the job at /api/jobs/{jobID}.
+func (cfg *ApiConfig) ImportChirpsHandler(w http.ResponseWriter, req *http.Request) {
+	principal := PrincipalFromContext(req.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	if cfg.RequireVerifiedEmail {
+		usr, err := cfg.Db.SelectUserById(req.Context(), principal.UserID)
+		if err != nil {
+			log.Printf("Error selecting usr: %s", err)
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !usr.EmailVerifiedAt.Valid {
+			respondWithError(w, http.StatusForbidden, "Email address not verified")
+			return
+		}
+	}
+
+	req.Body = http.MaxBytesReader(w, req.Body, maxImportSize)
+	file, header, err := req.FormFile("file")
+	if err != nil {
+		log.Printf("Error reading upload: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Expected a file upload of at most 20 MB in field \"file\"")
+		return
+	}
+	defer file.Close()
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	if format != "zip" && format != "csv" && format != "json" {
+		respondWithValidationErrors(w, map[string][]string{"file": {"must be a .zip, .csv or .json file"}})
+		return
+	}
+
+	// The upload is kept on disk so the job survives a restart.
+	err = os.MkdirAll(cfg.ImportDir, 0o700)
+	if err != nil {
+		log.Printf("Error creating import dir: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	name := uuid.NewString() + "." + format
+	dst, err := os.Create(filepath.Join(cfg.ImportDir, name))
+	if err == nil {
+		_, err = io.Copy(dst, file)
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Printf("Error saving upload: %s", err)
+		os.Remove(filepath.Join(cfg.ImportDir, name))
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	payload, _ := json.Marshal(import_payload{File: name, Format: format})
+	job, err := cfg.Db.CreateJob(req.Context(), database.CreateJobParams{
+		Type:    jobTypeImport,
+		Payload: payload,
+		UserID:  principal.UserID,
+	})
+	if err != nil {
+		log.Printf("Error creating import job: %s", err)
+		os.Remove(filepath.Join(cfg.ImportDir, name))
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID.String())
+	respondWithJSON(w, http.StatusAccepted, cfg.toJobModel(job, false))
+}
+
+// runImportJob can safely run again after an interruption, rows that were
+// already imported are detected and skipped.
+func (cfg *ApiConfig) runImportJob(ctx context.Context, job database.Job) (any, error) {
+	var payload import_payload
+	err := json.Unmarshal(job.Payload, &payload)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(cfg.ImportDir, filepath.Base(payload.File))
+	defer os.Remove(path)
+
+	rows, err := readImportRows(path, payload.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	res := import_result{Total: len(rows), Errors: []import_row_error{}}
+	for i, row := range rows {
+		// Row numbers count the CSV header as row 1, like spreadsheets do.
+		rowNum := i + 1
+		if payload.Format != "json" {
+			rowNum = i + 2
+		}
+		imported, err := cfg.importRow(ctx, job.UserID, row)
+		switch {
+		case err != nil:
+			res.Failed++
+			if len(res.Errors) < maxImportErrors {
+				res.Errors = append(res.Errors, import_row_error{Row: rowNum, Error: err.Error()})
+			}
+		case imported:
+			res.Imported++
+		default:
+			res.Skipped++
+		}
+
+		if (i+1)%importProgressEvery == 0 {
+			dat, _ := json.Marshal(res)
+			err = cfg.Db.UpdateJobProgress(ctx, database.UpdateJobProgressParams{ID: job.ID, Result: dat})
+			if err != nil {
+				log.Printf("Error saving import progress: %s", err)
+			}
+		}
+	}
+	return res, nil
+}
+
+// importRow reports false for rows that already exist.
+func (cfg *ApiConfig) importRow(ctx context.Context, userId uuid.UUID, row import_row) (bool, error) {
+	ts := row.CreatedAt
+	if ts == "" {
+		ts = row.Timestamp
+	}
+	createdAt, err := parseImportTime(ts)
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(row.Body) == "" {
+		return false, errors.New("body is empty")
+	}
+	body, err := prepareChirp(row.Body)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := cfg.Db.ImportChirp(ctx, database.ImportChirpParams{CreatedAt: createdAt, Body: body, UserID: userId})
+	if err != nil {
+		log.Printf("Error importing chirp: %s", err)
+		return false, errors.New("could not be saved")
+	}
+	return n == 1, nil
+}
+
+func parseImportTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, errors.New("timestamp is missing")
+	}
+	var t time.Time
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		t = time.Unix(secs, 0)
+	} else {
+		for _, layout := range importTimeLayouts {
+			t, err = time.Parse(layout, s)
+			if err == nil {
+				break
+			}
+		}
+		if t.IsZero() {
+			return time.Time{}, fmt.Errorf("timestamp %q not understood", s)
+		}
+	}
+	if t.After(time.Now()) {
+		return time.Time{}, errors.New("timestamp is in the future")
+	}
+	return t.UTC(), nil
+}
+
+func readImportRows(path, format string) ([]import_row, error) {
+	switch format {
+	case "zip":
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip archive: %w", err)
+		}
+		defer zr.Close()
+		// Our own export contains both, the JSON keeps bodies exactly.
+		for _, name := range []string{"chirps.json", "chirps.csv"} {
+			for _, f := range zr.File {
+				if f.Name != name {
+					continue
+				}
+				if f.UncompressedSize64 > maxImportUnpacked {
+					return nil, errImportTooLarge
+				}
+				r, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer r.Close()
+				return decodeImportRows(r, strings.TrimPrefix(filepath.Ext(name), "."))
+			}
+		}
+		return nil, errors.New("archive contains no chirps.json or chirps.csv")
+	case "csv", "json":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return decodeImportRows(f, format)
+	}
+	return nil, fmt.Errorf("unknown import format %q", format)
+}
+
+// cappedReader fails once more than the allowed bytes were read. Unlike
+// io.LimitReader alone it does not end silently, so a cut off file is not
+// taken for a complete one. The size in the ZIP header can not be trusted.
+type cappedReader struct {
+	r io.LimitedReader
+}
+
+func newCappedReader(r io.Reader, n int64) *cappedReader {
+	return &cappedReader{r: io.LimitedReader{R: r, N: n + 1}}
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if c.r.N <= 0 {
+		return n, errImportTooLarge
+	}
+	return n, err
+}
+
+func decodeImportRows(r io.Reader, format string) ([]import_row, error) {
+	r = newCappedReader(r, maxImportUnpacked)
+	if format == "json" {
+		return decodeImportJSON(r)
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	timeCol, bodyCol := -1, -1
+	for i, col := range header {
+		switch strings.ToLower(strings.TrimSpace(col)) {
+		case "created_at", "timestamp":
+			timeCol = i
+		case "body", "text":
+			bodyCol = i
+		}
+	}
+	if timeCol < 0 || bodyCol < 0 {
+		return nil, errors.New("CSV needs a header with timestamp and body columns")
+	}
+
+	rows := []import_row{}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if errors.Is(err, errImportTooLarge) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(rows) == maxImportRows {
+			return nil, errImportTooManyRows
+		}
+		var row import_row
+		if timeCol < len(record) {
+			row.CreatedAt = record[timeCol]
+		}
+		if bodyCol < len(record) {
+			row.Body = record[bodyCol]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// decodeImportJSON reads the array one chirp at a time, so the row limit
+// applies before everything is in memory.
+func decodeImportJSON(r io.Reader) ([]import_row, error) {
+	invalid := func(err error) error {
+		if errors.Is(err, errImportTooLarge) {
+			return err
+		}
+		return fmt.Errorf("invalid JSON, expected an array of chirps: %w", err)
+	}
+
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, invalid(err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, invalid(fmt.Errorf("found %v", tok))
+	}
+
+	rows := []import_row{}
+	for dec.More() {
+		if len(rows) == maxImportRows {
+			return nil, errImportTooManyRows
+		}
+		var row import_row
+		err = dec.Decode(&row)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		rows = append(rows, row)
+	}
+	_, err = dec.Token()
+	if err != nil {
+		return nil, invalid(err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	jobStatusDone = "done"
+	// Running jobs are touched this often. ClaimJob takes over jobs that
+	// were not updated for ten minutes.
+	jobHeartbeat = time.Minute
+)
+
+type job_model struct {
+	Id          string          `json:"id"`
+	Type        string          `json:"type"`
+	Status      string          `json:"status"`
+	CreatedAt   string          `json:"created_at"`
+	FinishedAt  *string         `json:"finished_at"`
+	Error       *string         `json:"error"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	DownloadUrl string          `json:"download_url,omitempty"`
+}
+
+// jobRunner does the work of one job type. The returned value is stored as
+// the job result.
+type jobRunner func(ctx context.Context, job database.Job) (any, error)
+
+func (cfg *ApiConfig) jobRunners() map[string]jobRunner {
+	return map[string]jobRunner{
+		jobTypeExport: cfg.runExportJob,
+		jobTypeImport: cfg.runImportJob,
+	}
+}
+
+// RunJobs works through the jobs table until ctx is done. Jobs are claimed
+// with SKIP LOCKED so several replicas can run this side by side. A job whose
+// worker died is picked up again once it was not updated for ten minutes.
+func (cfg *ApiConfig) RunJobs(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastCleanup time.Time
+	for {
+		err := cfg.Db.FailAbandonedJobs(ctx)
+		if err != nil {
+			log.Printf("Error failing abandoned jobs: %s", err)
+		}
+		for cfg.runNextJob(ctx) {
+		}
+		if time.Since(lastCleanup) > time.Hour {
+			cleanupFiles(cfg.ExportDir, exportRetention)
+			cleanupFiles(cfg.ImportDir, exportRetention)
+			lastCleanup = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNextJob reports whether a job was claimed.
+func (cfg *ApiConfig) runNextJob(ctx context.Context) bool {
+	job, err := cfg.Db.ClaimJob(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Error claiming job: %s", err)
+		return false
+	}
+
+	stop := cfg.heartbeatJob(ctx, job.ID)
+	result, err := cfg.runJob(ctx, job)
+	stop()
+	if err != nil {
+		log.Printf("Job %s (%s) failed: %s", job.ID, job.Type, err)
+		err = cfg.Db.FailJob(ctx, database.FailJobParams{ID: job.ID, Error: sql.NullString{String: err.Error(), Valid: true}})
+		if err != nil {
+			log.Printf("Error saving job %s: %s", job.ID, err)
+		}
+		return true
+	}
+
+	dat, err := json.Marshal(result)
+	if err == nil {
+		err = cfg.Db.CompleteJob(ctx, database.CompleteJobParams{ID: job.ID, Result: dat})
+	}
+	if err != nil {
+		log.Printf("Error saving job %s: %s", job.ID, err)
+	}
+	return true
+}
+
+// heartbeatJob keeps the job claimed while it runs, so long exports and
+// imports are not picked up by a second worker. The returned func stops it.
+func (cfg *ApiConfig) heartbeatJob(ctx context.Context, jobId uuid.UUID) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(jobHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := cfg.Db.TouchJob(ctx, jobId)
+				if err != nil && ctx.Err() == nil {
+					log.Printf("Error updating job %s: %s", jobId, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (cfg *ApiConfig) runJob(ctx context.Context, job database.Job) (result any, err error) {
+	runner, ok := cfg.jobRunners()[job.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown job type %q", job.Type)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return runner(ctx, job)
+}
+
+func (cfg *ApiConfig) GetJobHandler(w http.ResponseWriter, req *http.Request) {
+	principal := PrincipalFromContext(req.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	jobUuid, err := uuid.Parse(req.PathValue("jobID"))
+	if err != nil {
+		log.Printf("Error parsing job id: %s", err)
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	job, err := cfg.Db.GetJob(req.Context(), database.GetJobParams{ID: jobUuid, UserID: principal.UserID})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error selecting job: %s", err)
+		}
+		respondWithError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	// Links to personal data exports are only handed to login sessions.
+	respondWithJSON(w, http.StatusOK, cfg.toJobModel(job, principal.TokenType == TokenTypeSession))
+}
+
+func (cfg *ApiConfig) toJobModel(job database.Job, withDownload bool) job_model {
+	res := job_model{
+		Id:         job.ID.String(),
+		Type:       job.Type,
+		Status:     job.Status,
+		CreatedAt:  job.CreatedAt.String(),
+		FinishedAt: nullTimeString(job.FinishedAt),
+		Result:     job.Result,
+	}
+	if job.Error.Valid {
+		res.Error = &job.Error.String
+	}
+	if withDownload && job.Type == jobTypeExport && job.Status == jobStatusDone {
+		res.DownloadUrl = cfg.exportDownloadURL(job)
+	}
+	return res
+}
@@ -0,0 +1,9 @@
+package handlers
+
+import "net/http"
+
+func (cfg *ApiConfig) JWKSHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.JwtKeys.JWKS())
+}
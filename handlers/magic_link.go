@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/DmitrijP/my-go-server/internal/mail"
+)
+
+const (
+	magicLinkTTL        = 15 * time.Minute
+	magicLinkCookieName = "chirpy_magic"
+)
+
+type magic_link_request struct {
+	Email string `json:"email"`
+}
+
+func (cfg *ApiConfig) MagicLinkRequestHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(req.Body)
+	params := magic_link_request{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	ip := clientIP(req, cfg.TrustedProxies)
+	retryAfter, err := cfg.LoginLimiter.RetryAfter(req.Context(), params.Email, ip)
+	if err != nil || retryAfter > 0 {
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts")
+		return
+	}
+	retryAfter, err = cfg.MailLimiter.RetryAfter(req.Context(), params.Email, ip)
+	if err != nil {
+		log.Printf("Error checking sign-in emails: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many sign-in links requested")
+		return
+	}
+
+	// Every request counts, whether the email is known or not, so a known
+	// address can neither be flooded nor told apart by the limit.
+	err = cfg.MailLimiter.Attempted(req.Context(), params.Email, ip)
+	if err != nil {
+		log.Printf("Error recording sign-in email: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	// The nonce binds the link to this browser. A link forwarded to or
+	// intercepted by someone else can not be used without the cookie.
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating magic link nonce: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkCookieName,
+		Value:    nonce,
+		Path:     "/api/login/magic",
+		MaxAge:   int(magicLinkTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	usr, err := cfg.Db.SelectUserByEmail(req.Context(), params.Email)
+	if err != nil {
+		log.Printf("Magic link requested for unknown email: %s", err)
+		respondWithoutBody(w, http.StatusAccepted)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating magic link: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	_, err = cfg.Db.CreateMagicLinkToken(req.Context(), database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(magicLinkTTL),
+		NonceHash: auth.HashToken(nonce),
+		UserID:    usr.ID,
+	})
+	if err != nil {
+		log.Printf("Error saving magic link: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	link := fmt.Sprintf("%s/api/login/magic/%s", cfg.BaseURL, token)
+	if wantsCookieSession(req) {
+		link += "?session=cookie"
+	}
+	cfg.sendMail(mail.Message{
+		To:      usr.Email,
+		Subject: "Your Chirpy sign-in link",
+		Body: fmt.Sprintf("Open the link below in the same browser to sign in to Chirpy:\n\n"+
+			"%s\n\nThe link works once and expires in %d minutes.",
+			link, int(magicLinkTTL.Minutes())),
+	})
+
+	respondWithoutBody(w, http.StatusAccepted)
+}
+
+func (cfg *ApiConfig) MagicLinkLoginHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	cookie, err := req.Cookie(magicLinkCookieName)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Open the link in the browser you requested it from")
+		return
+	}
+
+	tok, err := cfg.Db.GetMagicLinkToken(req.Context(), auth.HashToken(req.PathValue("token")))
+	if err != nil {
+		log.Printf("Error selecting magic link: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Sign-in link invalid or expired")
+		return
+	}
+	if !auth.TokenHashEqual(cookie.Value, tok.NonceHash) {
+		respondWithError(w, http.StatusUnauthorized, "Open the link in the browser you requested it from")
+		return
+	}
+
+	used, err := cfg.Db.UseMagicLinkToken(req.Context(), tok.TokenHash)
+	if err != nil || used != 1 {
+		log.Printf("Magic link already used or expired: %v", err)
+		respondWithError(w, http.StatusUnauthorized, "Sign-in link invalid or expired")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: magicLinkCookieName, Path: "/api/login/magic", MaxAge: -1})
+
+	usr, err := cfg.Db.SelectUserById(req.Context(), tok.UserID)
+	if err != nil {
+		log.Printf("Error selecting usr: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Sign-in link invalid or expired")
+		return
+	}
+	cfg.issueSession(w, req, usr, wantsCookieSession(req))
+}
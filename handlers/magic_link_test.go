@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DmitrijP/my-go-server/internal/lockout"
+)
+
+func TestMagicLinkRequestIsRateLimited(t *testing.T) {
+	store := lockout.NewMemoryStore()
+	cfg := &ApiConfig{
+		LoginLimiter: lockout.NewLimiter(store),
+		MailLimiter:  lockout.NewMailLimiter(store),
+	}
+	for range cfg.MailLimiter.Account.FreeAttempts + 1 {
+		err := cfg.MailLimiter.Attempted(context.Background(), "a@example.com", "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login/magic", strings.NewReader(`{"email":"a@example.com"}`))
+	req.RemoteAddr = "198.51.100.7:1234"
+	rec := httptest.NewRecorder()
+	cfg.MagicLinkRequestHandler(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("got %d, want %d: %s", rec.Code, http.StatusTooManyRequests, rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Retry-After header missing")
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == magicLinkCookieName {
+			t.Errorf("limited request still set the magic link cookie")
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	dmFromEveryone = "everyone"
+	dmFromFollowed = "following"
+	dmFromNobody   = "nobody"
+
+	maxConversationMembers = 10
+	maxMessageLength       = 1000
+)
+
+var dmPermissions = []string{dmFromEveryone, dmFromFollowed, dmFromNobody}
+
+type conversation_create struct {
+	UserIds []string `json:"user_ids"`
+	// Body optionally sends the first message right away.
+	Body string `json:"body"`
+}
+
+type conversation_model struct {
+	Id            string   `json:"id"`
+	CreatedAt     string   `json:"created_at"`
+	MemberIds     []string `json:"member_ids"`
+	LastMessageAt *string  `json:"last_message_at"`
+	Unread        int32    `json:"unread"`
+}
+
+type message_create struct {
+	Body string `json:"body"`
+}
+
+type message_model struct {
+	Id             string `json:"id"`
+	CreatedAt      string `json:"created_at"`
+	ConversationId string `json:"conversation_id"`
+	SenderId       string `json:"sender_id"`
+	Body           string `json:"body"`
+}
+
+type messages_response struct {
+	Messages []message_model `json:"messages"`
+	// NextBefore is passed as ?before= to get older messages.
+	NextBefore string `json:"next_before,omitempty"`
+}
+
+type dm_settings struct {
+	AllowFrom string `json:"allow_from"`
+}
+
+func toMessageModel(msg database.Message) message_model {
+	return message_model{
+		Id:             msg.ID.String(),
+		CreatedAt:      msg.CreatedAt.String(),
+		ConversationId: msg.ConversationID.String(),
+		SenderId:       msg.SenderID.String(),
+		Body:           msg.Body,
+	}
+}
+
+func uuidStrings(ids []uuid.UUID) []string {
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, id.String())
+	}
+	return res
+}
+
+// dmAllowed tells if sender may start a conversation with recipient. A block
+// in either direction stops it, and "following" only lets in the people the
+// recipient follows.
+func (cfg *ApiConfig) dmAllowed(ctx context.Context, sender uuid.UUID, recipient database.User) (bool, error) {
+	if recipient.SuspendedAt.Valid || recipient.DmPermission == dmFromNobody {
+		return false, nil
+	}
+	blocked, err := cfg.Db.IsBlockedBetween(ctx, database.IsBlockedBetweenParams{UserA: sender, UserB: recipient.ID})
+	if err != nil || blocked {
+		return false, err
+	}
+	if recipient.DmPermission == dmFromFollowed {
+		return cfg.Db.IsFollowing(ctx, database.IsFollowingParams{FollowerID: recipient.ID, FolloweeID: sender})
+	}
+	return recipient.DmPermission == dmFromEveryone, nil
+}
+
+// directPairKey names the pair of a one-to-one conversation, the same for
+// both orders.
+func directPairKey(a, b uuid.UUID) string {
+	if a.String() > b.String() {
+		a, b = b, a
+	}
+	return "dm:" + a.String() + ":" + b.String()
+}
+
+func validMessageBody(body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	return body, body != "" && utf8.RuneCountInString(body) <= maxMessageLength
+}
+
+// CreateConversationHandler starts a conversation with one or more users.
+// A one-to-one conversation that already exists is reused.
+func (cfg *ApiConfig) CreateConversationHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+
+	params := conversation_create{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	members := []uuid.UUID{userId}
+	for _, s := range params.UserIds {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user id")
+			return
+		}
+		if !slices.Contains(members, id) {
+			members = append(members, id)
+		}
+	}
+	if len(members) < 2 || len(members) > maxConversationMembers {
+		respondWithError(w, http.StatusBadRequest, "A conversation needs 2 to 10 members")
+		return
+	}
+	body := ""
+	if params.Body != "" {
+		var ok bool
+		body, ok = validMessageBody(params.Body)
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, "Message must be 1 to 1000 characters")
+			return
+		}
+	}
+
+	for _, id := range members[1:] {
+		usr, err := cfg.Db.SelectUserById(req.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		if err != nil {
+			log.Printf("Error selecting usr: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		allowed, err := cfg.dmAllowed(req.Context(), userId, usr)
+		if err != nil {
+			log.Printf("Error checking dm permission: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		if !allowed {
+			respondWithError(w, http.StatusForbidden, "User "+id.String()+" does not accept messages from you")
+			return
+		}
+	}
+
+	status := http.StatusCreated
+	var conversation database.Conversation
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		var err error
+		if len(members) == 2 {
+			// Two requests for the same pair wait for each other, so only
+			// one of them creates the conversation.
+			err = q.LockDirectConversation(req.Context(), directPairKey(members[0], members[1]))
+			if err != nil {
+				return err
+			}
+			conversation, err = q.FindDirectConversation(req.Context(), database.FindDirectConversationParams{UserA: members[0], UserB: members[1]})
+			if err == nil {
+				status = http.StatusOK
+				return nil
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+		conversation, err = q.CreateConversation(req.Context(), database.CreateConversationParams{
+			CreatedBy: uuid.NullUUID{UUID: userId, Valid: true},
+			MemberIds: members,
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("Error creating conversation: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	res := conversation_model{
+		Id:            conversation.ID.String(),
+		CreatedAt:     conversation.CreatedAt.String(),
+		MemberIds:     uuidStrings(members),
+		LastMessageAt: nullTimeString(conversation.LastMessageAt),
+	}
+	if body != "" {
+		msg, err := cfg.Db.CreateMessage(req.Context(), database.CreateMessageParams{
+			ConversationID: conversation.ID,
+			SenderID:       userId,
+			Body:           body,
+		})
+		if err != nil {
+			log.Printf("Error creating message: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		lastMessageAt := msg.CreatedAt.String()
+		res.LastMessageAt = &lastMessageAt
+	}
+	respondWithJSON(w, status, res)
+}
+
+func (cfg *ApiConfig) ListConversationsHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+
+	conversations, err := cfg.Db.ListUserConversations(req.Context(), userId)
+	if err != nil {
+		log.Printf("Error selecting conversations: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	res := make([]conversation_model, 0, len(conversations))
+	for _, c := range conversations {
+		res = append(res, conversation_model{
+			Id:            c.ID.String(),
+			CreatedAt:     c.CreatedAt.String(),
+			MemberIds:     uuidStrings(c.MemberIds),
+			LastMessageAt: nullTimeString(c.LastMessageAt),
+			Unread:        c.Unread,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// conversationOfCaller returns the conversation from the path if the
+// caller is a member. Other conversations answer 404, so their ids are not
+// confirmed.
+func (cfg *ApiConfig) conversationOfCaller(w http.ResponseWriter, req *http.Request) (uuid.UUID, bool) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	conversationId, err := uuid.Parse(req.PathValue("conversationID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Conversation not found")
+		return uuid.Nil, false
+	}
+	_, err = cfg.Db.GetConversationMember(req.Context(), database.GetConversationMemberParams{
+		ConversationID: conversationId,
+		UserID:         userId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Conversation not found")
+		return uuid.Nil, false
+	}
+	if err != nil {
+		log.Printf("Error selecting conversation member: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return uuid.Nil, false
+	}
+	return conversationId, true
+}
+
+func (cfg *ApiConfig) SendMessageHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+	conversationId, ok := cfg.conversationOfCaller(w, req)
+	if !ok {
+		return
+	}
+
+	params := message_create{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+	body, ok := validMessageBody(params.Body)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Message must be 1 to 1000 characters")
+		return
+	}
+	// Blocks made after the conversation started still apply.
+	blocked, err := cfg.Db.IsBlockedInConversation(req.Context(), database.IsBlockedInConversationParams{
+		ConversationID: conversationId,
+		BlockedID:      userId,
+	})
+	if err != nil {
+		log.Printf("Error checking blocks: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if blocked {
+		respondWithError(w, http.StatusForbidden, "A member of this conversation blocked you")
+		return
+	}
+
+	msg, err := cfg.Db.CreateMessage(req.Context(), database.CreateMessageParams{
+		ConversationID: conversationId,
+		SenderID:       userId,
+		Body:           body,
+	})
+	if err != nil {
+		log.Printf("Error creating message: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, toMessageModel(msg))
+}
+
+// ListMessagesHandler returns messages newest first, paged with ?limit= and
+// ?before=.
+func (cfg *ApiConfig) ListMessagesHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	conversationId, ok := cfg.conversationOfCaller(w, req)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if v := req.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+	// Without before the database clock picks the newest messages.
+	var before sql.NullTime
+	if v := req.URL.Query().Get("before"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid before")
+			return
+		}
+		before = sql.NullTime{Time: t, Valid: true}
+	}
+
+	messages, err := cfg.Db.ListMessages(req.Context(), database.ListMessagesParams{
+		ConversationID: conversationId,
+		Before:         before,
+		MaxMessages:    int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error selecting messages: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	res := messages_response{Messages: []message_model{}}
+	for _, msg := range messages {
+		res.Messages = append(res.Messages, toMessageModel(msg))
+	}
+	if len(messages) == limit {
+		res.NextBefore = messages[len(messages)-1].CreatedAt.Format(time.RFC3339Nano)
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// MarkConversationReadHandler marks everything in the conversation up to
+// now as read.
+func (cfg *ApiConfig) MarkConversationReadHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+	conversationId, err := uuid.Parse(req.PathValue("conversationID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Conversation not found")
+		return
+	}
+	updated, err := cfg.Db.MarkConversationRead(req.Context(), database.MarkConversationReadParams{
+		ConversationID: conversationId,
+		UserID:         userId,
+	})
+	if err != nil {
+		log.Printf("Error marking conversation read: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if updated == 0 {
+		respondWithError(w, http.StatusNotFound, "Conversation not found")
+		return
+	}
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+// LeaveConversationHandler removes the caller from a conversation. They get
+// no more messages from it, and starting a conversation with the same user
+// again creates a new one, which dm-settings are checked for.
+func (cfg *ApiConfig) LeaveConversationHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+	conversationId, err := uuid.Parse(req.PathValue("conversationID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Conversation not found")
+		return
+	}
+	left, err := cfg.Db.LeaveConversation(req.Context(), database.LeaveConversationParams{
+		ConversationID: conversationId,
+		UserID:         userId,
+	})
+	if err != nil {
+		log.Printf("Error leaving conversation: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if left == 0 {
+		respondWithError(w, http.StatusNotFound, "Conversation not found")
+		return
+	}
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) GetDmSettingsHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+	usr, err := cfg.Db.SelectUserById(req.Context(), userId)
+	if err != nil {
+		log.Printf("Error selecting usr: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, dm_settings{AllowFrom: usr.DmPermission})
+}
+
+// UpdateDmSettingsHandler sets who can start conversations with the caller:
+// everyone, following (people the caller follows) or nobody. Conversations
+// that already exist are not affected, the caller leaves them to stop
+// getting messages.
+func (cfg *ApiConfig) UpdateDmSettingsHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+
+	params := dm_settings{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+	if !slices.Contains(dmPermissions, params.AllowFrom) {
+		respondWithValidationErrors(w, map[string][]string{"allow_from": {"must be one of everyone, following, nobody"}})
+		return
+	}
+
+	err = cfg.Db.UpdateDmPermission(req.Context(), database.UpdateDmPermissionParams{ID: userId, DmPermission: params.AllowFrom})
+	if err != nil {
+		log.Printf("Error updating dm permission: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, params)
+}
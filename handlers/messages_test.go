@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestDmAllowed(t *testing.T) {
+	sender, recipient := uuid.New(), uuid.New()
+	cases := []struct {
+		name       string
+		permission string
+		follows    bool
+		blocked    bool
+		want       bool
+	}{
+		{"everyone", dmFromEveryone, false, false, true},
+		{"everyone but blocked", dmFromEveryone, false, true, false},
+		{"following, followed", dmFromFollowed, true, false, true},
+		{"following, not followed", dmFromFollowed, false, false, false},
+		{"following, followed but blocked", dmFromFollowed, true, true, false},
+		{"nobody", dmFromNobody, true, false, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake, db := newFakeDB(t)
+			fake.on("IsBlockedBetween", func(args []driver.Value) fakeResult {
+				return fakeResult{columns: []string{"exists"}, rows: [][]driver.Value{{c.blocked}}}
+			})
+			fake.on("IsFollowing", func(args []driver.Value) fakeResult {
+				// Only the recipient following the sender counts.
+				follows := c.follows && args[0] == recipient.String() && args[1] == sender.String()
+				return fakeResult{columns: []string{"exists"}, rows: [][]driver.Value{{follows}}}
+			})
+			cfg := &ApiConfig{Db: db}
+
+			usr := database.User{ID: recipient, DmPermission: c.permission}
+			got, err := cfg.dmAllowed(context.Background(), sender, usr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Errorf("dmAllowed = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidMessageBodyCountsCharacters(t *testing.T) {
+	cases := []struct {
+		body string
+		want bool
+	}{
+		{"", false},
+		{"   ", false},
+		{"hi", true},
+		{strings.Repeat("ä", maxMessageLength), true},
+		{strings.Repeat("ä", maxMessageLength+1), false},
+	}
+	for _, c := range cases {
+		if _, ok := validMessageBody(c.body); ok != c.want {
+			t.Errorf("validMessageBody(%d bytes) = %v, want %v", len(c.body), ok, c.want)
+		}
+	}
+}
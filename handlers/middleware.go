@@ -1,6 +1,10 @@
 package handlers
 
-import "net/http"
+import (
+	"errors"
+	"log"
+	"net/http"
+)
 
 func (cfg *ApiConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -8,3 +12,92 @@ func (cfg *ApiConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
 		next.ServeHTTP(w, req)
 	})
 }
+
+// RequireAuth rejects requests without a valid token and stores the caller
+// in the request context for the handlers behind it.
+func (cfg *ApiConfig) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p, err := cfg.resolvePrincipal(req)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(withPrincipal(req.Context(), p)))
+	})
+}
+
+// OptionalAuth lets anonymous requests through, but a token that is sent
+// has to be valid. Handlers behind it check IsAuthenticated.
+func (cfg *ApiConfig) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p, err := cfg.resolvePrincipal(req)
+		if errors.Is(err, errNoToken) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(withPrincipal(req.Context(), p)))
+	})
+}
+
+// RequireScope has to run behind RequireAuth.
+func RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !PrincipalFromContext(req.Context()).HasScope(scope) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			respondWithError(w, http.StatusForbidden, "Token is missing scope "+scope)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// RequireSession only lets first party logins through. It guards the token,
+// passkey and client management, so a leaked access token can not mint new
+// credentials. It has to run behind RequireAuth.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if PrincipalFromContext(req.Context()).TokenType != TokenTypeSession {
+			w.Header().Set("Content-Type", "application/json")
+			respondWithError(w, http.StatusForbidden, "This endpoint requires a login session")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// RequireRole has to run behind RequireAuth.
+func RequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p := PrincipalFromContext(req.Context())
+		if p.Role != role || p.TokenType != TokenTypeSession {
+			w.Header().Set("Content-Type", "application/json")
+			respondWithError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if errors.Is(err, errCSRFMismatch) {
+		respondWithError(w, http.StatusForbidden, "CSRF token missing or invalid")
+		return
+	}
+	if errors.Is(err, errSuspended) {
+		respondWithError(w, http.StatusForbidden, "Account suspended")
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy"`)
+	if errors.Is(err, errNoToken) {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	log.Printf("Error authenticating request: %s", err)
+	respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
+}
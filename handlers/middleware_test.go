@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+	"github.com/DmitrijP/my-go-server/internal/revocation"
+	"github.com/google/uuid"
+)
+
+func TestOptionalAuth(t *testing.T) {
+	userId := uuid.New()
+	fake, db := newFakeDB(t)
+	fake.on("SelectUserById", func(args []driver.Value) fakeResult {
+		return userRow(userId)
+	})
+	cfg := &ApiConfig{
+		Db:          db,
+		JwtKeys:     auth.NewKeySet("secret"),
+		Revocations: revocation.NewList(noRevocations{}),
+	}
+	token, err := auth.MakeJWT(userId, cfg.JwtKeys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen Principal
+	handler := cfg.OptionalAuth(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seen = PrincipalFromContext(req.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		name          string
+		authorization string
+		wantCode      int
+		wantUser      uuid.UUID
+	}{
+		{"anonymous", "", http.StatusOK, uuid.Nil},
+		{"valid token", "Bearer " + token, http.StatusOK, userId},
+		{"bad token", "Bearer not-a-jwt", http.StatusUnauthorized, uuid.Nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			seen = Principal{}
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+			if c.authorization != "" {
+				req.Header.Set("Authorization", c.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != c.wantCode {
+				t.Fatalf("got %d, want %d: %s", rec.Code, c.wantCode, rec.Body.String())
+			}
+			if seen.UserID != c.wantUser {
+				t.Errorf("principal user = %v, want %v", seen.UserID, c.wantUser)
+			}
+			if seen.IsAuthenticated() != (c.wantUser != uuid.Nil) {
+				t.Errorf("IsAuthenticated = %v", seen.IsAuthenticated())
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	notificationLike    = "like"
+	notificationReply   = "reply"
+	notificationMention = "mention"
+	notificationFollow  = "follow"
+)
+
+// notificationTypes are the types that are written. Likes and replies target
+// the chirp that was liked or answered, mentions the chirp that mentions the
+// user, and follows have no target.
+var notificationTypes = []string{notificationLike, notificationReply, notificationMention, notificationFollow}
+
+// notification_group_model stands for all notifications of one type and
+// target, for example every like of one chirp. Clients render it as
+// "<first actor> and <actor_count - 1> others liked your chirp".
+type notification_group_model struct {
+	Type       string   `json:"type"`
+	TargetId   *string  `json:"target_id"`
+	ActorIds   []string `json:"actor_ids"`
+	ActorCount int32    `json:"actor_count"`
+	Unread     int32    `json:"unread"`
+	LatestAt   string   `json:"latest_at"`
+}
+
+type notifications_response struct {
+	UnreadCount   int64                      `json:"unread_count"`
+	Notifications []notification_group_model `json:"notifications"`
+	// NextBefore is passed as ?before= to get the next page.
+	NextBefore string `json:"next_before,omitempty"`
+}
+
+type notification_group_ref struct {
+	Type     string  `json:"type"`
+	TargetId *string `json:"target_id"`
+}
+
+type notifications_read struct {
+	All    bool                     `json:"all"`
+	Groups []notification_group_ref `json:"groups"`
+}
+
+type unread_count_model struct {
+	UnreadCount int64 `json:"unread_count"`
+}
+
+// notify records that actor did something to recipient, unless recipient
+// turned that type off. Nobody is notified about their own actions.
+func (cfg *ApiConfig) notify(ctx context.Context, recipient, actor uuid.UUID, notificationType string, target uuid.NullUUID) error {
+	if recipient == actor {
+		return nil
+	}
+	_, err := cfg.Db.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:   recipient,
+		ActorID:  actor,
+		Type:     notificationType,
+		TargetID: target,
+	})
+	return err
+}
+
+func (cfg *ApiConfig) ListNotificationsHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+
+	limit := 20
+	if v := req.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+	// Without before the database clock picks the newest groups.
+	var before sql.NullTime
+	if v := req.URL.Query().Get("before"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid before")
+			return
+		}
+		before = sql.NullTime{Time: t, Valid: true}
+	}
+
+	unread, err := cfg.Db.CountUnreadNotifications(req.Context(), userId)
+	if err != nil {
+		log.Printf("Error counting notifications: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	groups, err := cfg.Db.ListNotificationGroups(req.Context(), database.ListNotificationGroupsParams{
+		UserID:    userId,
+		Before:    before,
+		MaxGroups: int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error selecting notifications: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	res := notifications_response{UnreadCount: unread, Notifications: []notification_group_model{}}
+	for _, group := range groups {
+		model := notification_group_model{
+			Type:       group.Type,
+			ActorCount: group.ActorCount,
+			Unread:     group.Unread,
+			LatestAt:   group.LatestAt.String(),
+		}
+		if group.TargetID.Valid {
+			target := group.TargetID.UUID.String()
+			model.TargetId = &target
+		}
+		for _, actor := range group.ActorIds {
+			model.ActorIds = append(model.ActorIds, actor.String())
+		}
+		res.Notifications = append(res.Notifications, model)
+	}
+	if len(groups) == limit {
+		res.NextBefore = groups[len(groups)-1].LatestAt.Format(time.RFC3339Nano)
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// MarkNotificationsReadHandler marks whole groups as read, or everything
+// with {"all": true}.
+func (cfg *ApiConfig) MarkNotificationsReadHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+
+	params := notifications_read{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+	if !params.All && len(params.Groups) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Either all or groups is required")
+		return
+	}
+	if len(params.Groups) > 100 {
+		respondWithError(w, http.StatusBadRequest, "At most 100 groups at once")
+		return
+	}
+
+	if params.All {
+		_, err = cfg.Db.MarkAllNotificationsRead(req.Context(), userId)
+	}
+	for _, group := range params.Groups {
+		if err != nil {
+			break
+		}
+		target := uuid.NullUUID{}
+		if group.TargetId != nil {
+			id, parseErr := uuid.Parse(*group.TargetId)
+			if parseErr != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid target_id")
+				return
+			}
+			target = uuid.NullUUID{UUID: id, Valid: true}
+		}
+		_, err = cfg.Db.MarkNotificationsRead(req.Context(), database.MarkNotificationsReadParams{
+			UserID:   userId,
+			Type:     group.Type,
+			TargetID: target,
+		})
+	}
+	if err != nil {
+		log.Printf("Error marking notifications read: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	unread, err := cfg.Db.CountUnreadNotifications(req.Context(), userId)
+	if err != nil {
+		log.Printf("Error counting notifications: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, unread_count_model{UnreadCount: unread})
+}
+
+// GetNotificationPreferencesHandler returns whether each notification type
+// is turned on. Types are on until the user turns them off.
+func (cfg *ApiConfig) GetNotificationPreferencesHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+	cfg.respondWithNotificationPreferences(w, req, userId)
+}
+
+// UpdateNotificationPreferencesHandler takes a map like {"like": false}.
+// Types that are left out keep their setting.
+func (cfg *ApiConfig) UpdateNotificationPreferencesHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+	w.Header().Set("Content-Type", "application/json")
+
+	params := map[string]bool{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+	var problems []string
+	for notificationType := range params {
+		if !slices.Contains(notificationTypes, notificationType) {
+			problems = append(problems, fmt.Sprintf("unknown notification type %q", notificationType))
+		}
+	}
+	if len(problems) > 0 {
+		respondWithValidationErrors(w, map[string][]string{"preferences": problems})
+		return
+	}
+
+	for notificationType, enabled := range params {
+		err = cfg.Db.UpsertNotificationPreference(req.Context(), database.UpsertNotificationPreferenceParams{
+			UserID:  userId,
+			Type:    notificationType,
+			Enabled: enabled,
+		})
+		if err != nil {
+			log.Printf("Error updating notification preference: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+	}
+	cfg.respondWithNotificationPreferences(w, req, userId)
+}
+
+func (cfg *ApiConfig) respondWithNotificationPreferences(w http.ResponseWriter, req *http.Request, userId uuid.UUID) {
+	prefs, err := cfg.Db.ListNotificationPreferences(req.Context(), userId)
+	if err != nil {
+		log.Printf("Error selecting notification preferences: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	res := map[string]bool{}
+	for _, notificationType := range notificationTypes {
+		res[notificationType] = true
+	}
+	for _, pref := range prefs {
+		res[pref.Type] = pref.Enabled
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,606 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	oauthCodeTTL         = 10 * time.Minute
+	oauthAccessTokenTTL  = time.Hour
+	oauthRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type oauth_client_create struct {
+	Name         string   `json:"name"`
+	RedirectUris []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+type oauth_client_model struct {
+	ClientId     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Name         string   `json:"name"`
+	RedirectUris []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	CreatedAt    string   `json:"created_at"`
+}
+
+type oauth_error struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type oauth_token_response struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+type oauth_introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+}
+
+type authorize_request struct {
+	ClientID      string
+	ClientName    string
+	RedirectURI   string
+	Scope         string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+	Error         string
+}
+
+var (
+	consentOnce     sync.Once
+	consentTemplate *template.Template
+	consentErr      error
+)
+
+func renderConsent(w http.ResponseWriter, code int, ar authorize_request) {
+	consentOnce.Do(func() {
+		consentTemplate, consentErr = template.ParseFiles("./html/oauth/consent.html")
+	})
+	if consentErr != nil {
+		log.Printf("Error loading consent page: %s", consentErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(code)
+	err := consentTemplate.Execute(w, ar)
+	if err != nil {
+		log.Printf("Error rendering consent page: %s", err)
+	}
+}
+
+func respondWithOAuthError(w http.ResponseWriter, code int, errCode, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, code, oauth_error{Error: errCode, ErrorDescription: description})
+}
+
+func redirectWithOAuthError(w http.ResponseWriter, req *http.Request, redirectURI, state, errCode, description string) {
+	v := url.Values{}
+	v.Set("error", errCode)
+	v.Set("error_description", description)
+	if state != "" {
+		v.Set("state", state)
+	}
+	http.Redirect(w, req, appendQuery(redirectURI, v), http.StatusFound)
+}
+
+func appendQuery(rawURL string, v url.Values) string {
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + v.Encode()
+	}
+	return rawURL + "?" + v.Encode()
+}
+
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Fragment != "" || u.Host == "" {
+		return false
+	}
+	if u.Scheme == "https" {
+		return true
+	}
+	host := u.Hostname()
+	return u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1")
+}
+
+func (cfg *ApiConfig) CreateOAuthClientHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(req.Body)
+	params := oauth_client_create{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	fields := map[string][]string{}
+	if strings.TrimSpace(params.Name) == "" {
+		fields["name"] = append(fields["name"], "must not be empty")
+	}
+	if len(params.RedirectUris) == 0 {
+		fields["redirect_uris"] = append(fields["redirect_uris"], "must contain at least one uri")
+	}
+	for _, uri := range params.RedirectUris {
+		if !validRedirectURI(uri) {
+			fields["redirect_uris"] = append(fields["redirect_uris"], "must be https or a localhost url without fragment: "+uri)
+		}
+	}
+	if len(params.Scopes) == 0 {
+		fields["scopes"] = append(fields["scopes"], "must contain at least one scope")
+	}
+	for _, scope := range params.Scopes {
+		if !auth.IsKnownScope(scope) {
+			fields["scopes"] = append(fields["scopes"], "unknown scope "+scope)
+		}
+	}
+	if len(fields) > 0 {
+		respondWithValidationErrors(w, fields)
+		return
+	}
+
+	clientId, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating client id: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	clientId = "chirpy_" + clientId[:32]
+
+	var secret string
+	var secretHash sql.NullString
+	if params.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			log.Printf("Error creating client secret: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.Db.CreateOAuthClient(req.Context(), database.CreateOAuthClientParams{
+		ID:           clientId,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: strings.Join(params.RedirectUris, " "),
+		Scopes:       strings.Join(params.Scopes, " "),
+		UserID:       userId,
+	})
+	if err != nil {
+		log.Printf("Error saving client: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, oauth_client_model{
+		ClientId:     client.ID,
+		ClientSecret: secret,
+		Name:         client.Name,
+		RedirectUris: strings.Fields(client.RedirectUris),
+		Scopes:       auth.ParseScopes(client.Scopes),
+		CreatedAt:    client.CreatedAt.String(),
+	})
+}
+
+// parseAuthorizeRequest validates the parameters of an authorization
+// request. Errors found before the redirect uri is known to be registered
+// are answered directly, everything else is sent back to the client.
+func (cfg *ApiConfig) parseAuthorizeRequest(w http.ResponseWriter, req *http.Request) (authorize_request, bool) {
+	v := req.Form
+	ar := authorize_request{
+		ClientID:      v.Get("client_id"),
+		RedirectURI:   v.Get("redirect_uri"),
+		State:         v.Get("state"),
+		CodeChallenge: v.Get("code_challenge"),
+	}
+
+	client, err := cfg.Db.GetOAuthClient(req.Context(), ar.ClientID)
+	if err != nil {
+		log.Printf("Error selecting oauth client: %s", err)
+		http.Error(w, "Unknown client", http.StatusBadRequest)
+		return ar, false
+	}
+	ar.ClientName = client.Name
+
+	registered := strings.Fields(client.RedirectUris)
+	if ar.RedirectURI == "" && len(registered) == 1 {
+		ar.RedirectURI = registered[0]
+	}
+	if !slices.Contains(registered, ar.RedirectURI) {
+		http.Error(w, "Redirect uri is not registered for this client", http.StatusBadRequest)
+		return ar, false
+	}
+
+	if v.Get("response_type") != "code" {
+		redirectWithOAuthError(w, req, ar.RedirectURI, ar.State, "unsupported_response_type", "only the code response type is supported")
+		return ar, false
+	}
+	if ar.CodeChallenge == "" || v.Get("code_challenge_method") != "S256" {
+		redirectWithOAuthError(w, req, ar.RedirectURI, ar.State, "invalid_request", "PKCE with code_challenge_method S256 is required")
+		return ar, false
+	}
+
+	allowed := auth.ParseScopes(client.Scopes)
+	ar.Scopes = auth.ParseScopes(v.Get("scope"))
+	if len(ar.Scopes) == 0 {
+		ar.Scopes = allowed
+	}
+	for _, scope := range ar.Scopes {
+		if !slices.Contains(allowed, scope) {
+			redirectWithOAuthError(w, req, ar.RedirectURI, ar.State, "invalid_scope", "scope not allowed for this client: "+scope)
+			return ar, false
+		}
+	}
+	ar.Scope = strings.Join(ar.Scopes, " ")
+	return ar, true
+}
+
+func (cfg *ApiConfig) OAuthAuthorizeHandler(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, "Malformed request", http.StatusBadRequest)
+		return
+	}
+	ar, ok := cfg.parseAuthorizeRequest(w, req)
+	if !ok {
+		return
+	}
+	renderConsent(w, http.StatusOK, ar)
+}
+
+func (cfg *ApiConfig) OAuthConsentHandler(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, "Malformed request", http.StatusBadRequest)
+		return
+	}
+	ar, ok := cfg.parseAuthorizeRequest(w, req)
+	if !ok {
+		return
+	}
+
+	if req.PostForm.Get("decision") != "approve" {
+		redirectWithOAuthError(w, req, ar.RedirectURI, ar.State, "access_denied", "the user denied the request")
+		return
+	}
+
+	email := req.PostForm.Get("email")
+	ip := clientIP(req, cfg.TrustedProxies)
+	retryAfter, err := cfg.LoginLimiter.RetryAfter(req.Context(), email, ip)
+	if err != nil || retryAfter > 0 {
+		ar.Error = "Too many failed login attempts, try again later"
+		renderConsent(w, http.StatusTooManyRequests, ar)
+		return
+	}
+
+	usr, err := cfg.Db.SelectUserByEmail(req.Context(), email)
+	hash := usr.HashedPassword
+	if err != nil {
+		hash = dummyPasswordHash()
+	}
+	pwErr := auth.CheckPasswordHash(req.PostForm.Get("password"), hash)
+	if err != nil || pwErr != nil {
+		err = cfg.LoginLimiter.Failed(req.Context(), email, ip)
+		if err != nil {
+			log.Printf("Error recording login attempt: %s", err)
+		}
+		ar.Error = "Incorrect email or password"
+		renderConsent(w, http.StatusUnauthorized, ar)
+		return
+	}
+	err = cfg.LoginLimiter.Succeeded(req.Context(), email)
+	if err != nil {
+		log.Printf("Error resetting login attempts: %s", err)
+	}
+	if usr.SuspendedAt.Valid {
+		ar.Error = "Account suspended"
+		renderConsent(w, http.StatusForbidden, ar)
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating authorization code: %s", err)
+		redirectWithOAuthError(w, req, ar.RedirectURI, ar.State, "server_error", "")
+		return
+	}
+	_, err = cfg.Db.CreateOAuthCode(req.Context(), database.CreateOAuthCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ExpiresAt:     time.Now().Add(oauthCodeTTL),
+		RedirectUri:   ar.RedirectURI,
+		Scopes:        ar.Scope,
+		CodeChallenge: ar.CodeChallenge,
+		ClientID:      ar.ClientID,
+		UserID:        usr.ID,
+	})
+	if err != nil {
+		log.Printf("Error saving authorization code: %s", err)
+		redirectWithOAuthError(w, req, ar.RedirectURI, ar.State, "server_error", "")
+		return
+	}
+
+	v := url.Values{}
+	v.Set("code", code)
+	if ar.State != "" {
+		v.Set("state", ar.State)
+	}
+	http.Redirect(w, req, appendQuery(ar.RedirectURI, v), http.StatusFound)
+}
+
+// authenticateClient accepts client_secret_basic and client_secret_post.
+// Public clients only send their client_id and rely on PKCE.
+func (cfg *ApiConfig) authenticateClient(req *http.Request) (database.OauthClient, error) {
+	clientId, secret, basic := req.BasicAuth()
+	if !basic {
+		clientId = req.PostForm.Get("client_id")
+		secret = req.PostForm.Get("client_secret")
+	}
+
+	client, err := cfg.Db.GetOAuthClient(req.Context(), clientId)
+	if err != nil {
+		return client, errors.New("unknown client")
+	}
+	if client.SecretHash.Valid && !auth.TokenHashEqual(secret, client.SecretHash.String) {
+		return client, errors.New("wrong client secret")
+	}
+	return client, nil
+}
+
+func (cfg *ApiConfig) OAuthTokenHandler(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	client, err := cfg.authenticateClient(req)
+	if err != nil {
+		log.Printf("Error authenticating oauth client: %s", err)
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+
+	switch req.PostForm.Get("grant_type") {
+	case "authorization_code":
+		cfg.exchangeAuthorizationCode(w, req, client)
+	case "refresh_token":
+		cfg.exchangeRefreshToken(w, req, client)
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+func (cfg *ApiConfig) exchangeAuthorizationCode(w http.ResponseWriter, req *http.Request, client database.OauthClient) {
+	code, err := cfg.Db.GetOAuthCode(req.Context(), auth.HashToken(req.PostForm.Get("code")))
+	if err != nil || code.ClientID != client.ID {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "unknown authorization code")
+		return
+	}
+	if code.RedirectUri != req.PostForm.Get("redirect_uri") {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+		return
+	}
+	if !auth.VerifyPKCE(req.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match")
+		return
+	}
+
+	used, err := cfg.Db.UseOAuthCode(req.Context(), code.CodeHash)
+	if err != nil || used != 1 {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "authorization code expired or already used")
+		return
+	}
+
+	cfg.issueClientTokens(w, req, client, code.UserID, code.Scopes)
+}
+
+func (cfg *ApiConfig) exchangeRefreshToken(w http.ResponseWriter, req *http.Request, client database.OauthClient) {
+	tok, err := cfg.Db.GetOneToken(req.Context(), req.PostForm.Get("refresh_token"))
+	if err != nil || tok.ClientID.String != client.ID {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "unknown refresh token")
+		return
+	}
+	if tok.RevokedAt.Valid || tok.ExpiresAt.Before(time.Now()) {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh token expired or revoked")
+		return
+	}
+
+	// A narrower scope may be requested, never a wider one.
+	scopes := tok.Scopes
+	if requested := auth.ParseScopes(req.PostForm.Get("scope")); len(requested) > 0 {
+		granted := auth.ParseScopes(tok.Scopes)
+		for _, scope := range requested {
+			if !slices.Contains(granted, scope) {
+				respondWithOAuthError(w, http.StatusBadRequest, "invalid_scope", "scope was not granted: "+scope)
+				return
+			}
+		}
+		scopes = strings.Join(requested, " ")
+	}
+
+	err = cfg.Db.RevokeToken(req.Context(), tok.Token)
+	if err != nil {
+		log.Printf("Refresh revokation failed: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	cfg.issueClientTokens(w, req, client, tok.UserID, scopes)
+}
+
+func (cfg *ApiConfig) issueClientTokens(w http.ResponseWriter, req *http.Request, client database.OauthClient, userId uuid.UUID, scopes string) {
+	access, err := auth.MakeClientJWT(userId, client.ID, auth.ParseScopes(scopes), cfg.JwtKeys, oauthAccessTokenTTL)
+	if err != nil {
+		log.Printf("Error creating jwt: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	refresh, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating refresh: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	_, err = cfg.Db.CreateClientToken(req.Context(), database.CreateClientTokenParams{
+		Token:     refresh,
+		ExpiresAt: time.Now().Add(oauthRefreshTokenTTL),
+		UserID:    userId,
+		ClientID:  sql.NullString{String: client.ID, Valid: true},
+		Scopes:    scopes,
+	})
+	if err != nil {
+		log.Printf("Error creating refresh: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, oauth_token_response{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refresh,
+		Scope:        scopes,
+	})
+}
+
+// OAuthRevokeHandler implements RFC 7009. Access and refresh tokens of the
+// calling client can be revoked, others are ignored.
+func (cfg *ApiConfig) OAuthRevokeHandler(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	client, err := cfg.authenticateClient(req)
+	if err != nil {
+		log.Printf("Error authenticating oauth client: %s", err)
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+
+	token := req.PostForm.Get("token")
+	if claims, err := auth.ParseJWT(token, cfg.JwtKeys); err == nil {
+		if claims.ClientID == client.ID {
+			err = cfg.Revocations.Revoke(req.Context(), claims.ID, claims.ExpiresAt.Time)
+			if err != nil {
+				log.Printf("Access token revokation failed: %s", err)
+				respondWithOAuthError(w, http.StatusServiceUnavailable, "server_error", "")
+				return
+			}
+		}
+		respondWithoutBody(w, http.StatusOK)
+		return
+	}
+
+	tok, err := cfg.Db.GetOneToken(req.Context(), token)
+	if err == nil && tok.ClientID.String == client.ID {
+		err = cfg.Db.RevokeToken(req.Context(), tok.Token)
+		if err != nil {
+			log.Printf("Refresh revokation failed: %s", err)
+			respondWithOAuthError(w, http.StatusServiceUnavailable, "server_error", "")
+			return
+		}
+	}
+	respondWithoutBody(w, http.StatusOK)
+}
+
+// OAuthIntrospectHandler implements RFC 7662 for confidential clients. A
+// client only learns about tokens that were issued to it; every other token
+// is reported as inactive.
+func (cfg *ApiConfig) OAuthIntrospectHandler(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	client, err := cfg.authenticateClient(req)
+	if err != nil {
+		log.Printf("Error authenticating oauth client: %s", err)
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+	if !client.SecretHash.Valid {
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "introspection requires a confidential client")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	token := req.PostForm.Get("token")
+
+	if claims, usr, err := cfg.validateJWT(req.Context(), token); err == nil && claims.ClientID == client.ID && !usr.SuspendedAt.Valid {
+		res := oauth_introspection{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientId:  claims.ClientID,
+			Sub:       claims.Subject,
+			Iss:       claims.Issuer,
+			TokenType: "Bearer",
+		}
+		if claims.ExpiresAt != nil {
+			res.Exp = claims.ExpiresAt.Unix()
+		}
+		if claims.IssuedAt != nil {
+			res.Iat = claims.IssuedAt.Unix()
+		}
+		respondWithJSON(w, http.StatusOK, res)
+		return
+	}
+
+	tok, err := cfg.Db.GetOneToken(req.Context(), token)
+	if err == nil && tok.ClientID.String == client.ID && !tok.RevokedAt.Valid && tok.ExpiresAt.After(time.Now()) {
+		respondWithJSON(w, http.StatusOK, oauth_introspection{
+			Active:    true,
+			Scope:     tok.Scopes,
+			ClientId:  client.ID,
+			Sub:       tok.UserID.String(),
+			Exp:       tok.ExpiresAt.Unix(),
+			Iat:       tok.CreatedAt.Unix(),
+			Iss:       "chirpy",
+			TokenType: "refresh_token",
+		})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, oauth_introspection{Active: false})
+}
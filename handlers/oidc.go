@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+	"github.com/DmitrijP/my-go-server/internal/database"
+)
+
+const oidcCookieName = "chirpy_oidc"
+
+func (cfg *ApiConfig) secureCookies() bool {
+	return strings.HasPrefix(cfg.BaseURL, "https://")
+}
+
+func (cfg *ApiConfig) OIDCLoginHandler(w http.ResponseWriter, req *http.Request) {
+	if cfg.OIDC == nil {
+		respondWithError(w, http.StatusNotFound, "OpenID Connect login is not configured")
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		v, err := auth.MakeRefreshToken()
+		if err != nil {
+			log.Printf("Error creating oidc state: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	redirect, err := cfg.OIDC.AuthCodeURL(req.Context(), state, nonce, auth.PKCEChallenge(verifier))
+	if err != nil {
+		log.Printf("Error building oidc redirect: %s", err)
+		respondWithError(w, http.StatusBadGateway, "Identity provider unavailable")
+		return
+	}
+
+	mode := "bearer"
+	if wantsCookieSession(req) {
+		mode = "cookie"
+	}
+
+	// SameSite=Lax so the cookie is sent along on the top level redirect
+	// back from the identity provider.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    state + "." + nonce + "." + verifier + "." + mode,
+		Path:     "/api/login/oidc",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, req, redirect, http.StatusFound)
+}
+
+func (cfg *ApiConfig) OIDCCallbackHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if cfg.OIDC == nil {
+		respondWithError(w, http.StatusNotFound, "OpenID Connect login is not configured")
+		return
+	}
+
+	cookie, err := req.Cookie(oidcCookieName)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Login session expired, please try again")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcCookieName, Path: "/api/login/oidc", MaxAge: -1})
+
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 4 {
+		respondWithError(w, http.StatusBadRequest, "Login session expired, please try again")
+		return
+	}
+	state, nonce, verifier, mode := parts[0], parts[1], parts[2], parts[3]
+
+	query := req.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		respondWithError(w, http.StatusBadRequest, "Invalid login state")
+		return
+	}
+	if e := query.Get("error"); e != "" {
+		log.Printf("OIDC provider returned error: %s %s", e, query.Get("error_description"))
+		respondWithError(w, http.StatusUnauthorized, "Login was cancelled or rejected")
+		return
+	}
+
+	rawIDToken, err := cfg.OIDC.Exchange(req.Context(), query.Get("code"), verifier)
+	if err != nil {
+		log.Printf("Error exchanging oidc code: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Login failed")
+		return
+	}
+	claims, err := cfg.OIDC.VerifyIDToken(req.Context(), rawIDToken, nonce)
+	if err != nil {
+		log.Printf("Error verifying id token: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Login failed")
+		return
+	}
+
+	usr, status, msg := cfg.resolveIdentity(req, claims.Issuer, claims.Subject, claims.Email, claims.EmailVerified)
+	if status != 0 {
+		respondWithError(w, status, msg)
+		return
+	}
+	cfg.issueSession(w, req, usr, mode == "cookie")
+}
+
+// resolveIdentity finds the user behind an external identity. Unknown
+// identities are linked to the account with the same email address, but only
+// when both the provider and Chirpy have verified that address. Without a
+// matching account a new one is created.
+func (cfg *ApiConfig) resolveIdentity(req *http.Request, provider, subject, email string, emailVerified bool) (database.User, int, string) {
+	ctx := req.Context()
+	identity, err := cfg.Db.GetUserIdentity(ctx, database.GetUserIdentityParams{Provider: provider, Subject: subject})
+	if err == nil {
+		usr, err := cfg.Db.SelectUserById(ctx, identity.UserID)
+		if err != nil {
+			log.Printf("Error selecting usr: %s", err)
+			return usr, http.StatusInternalServerError, "Something went wrong"
+		}
+		return usr, 0, ""
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error selecting identity: %s", err)
+		return database.User{}, http.StatusInternalServerError, "Something went wrong"
+	}
+
+	if email == "" || !emailVerified {
+		return database.User{}, http.StatusForbidden, "The identity provider did not confirm your email address"
+	}
+
+	usr, err := cfg.Db.SelectUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		if !usr.EmailVerifiedAt.Valid {
+			return usr, http.StatusConflict, "An account with this email exists but is not verified, please verify it first"
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		// External accounts get a password nobody knows. A password can be
+		// set later through the password reset flow.
+		usr, err = cfg.Db.CreateVerifiedUser(ctx, database.CreateVerifiedUserParams{Email: email, HashedPassword: "unset"})
+		if err != nil {
+			log.Printf("Error creating user: %s", err)
+			return usr, http.StatusInternalServerError, "Something went wrong"
+		}
+	default:
+		log.Printf("Error selecting user: %s", err)
+		return usr, http.StatusInternalServerError, "Something went wrong"
+	}
+
+	_, err = cfg.Db.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+		UserID:   usr.ID,
+	})
+	if err != nil {
+		log.Printf("Error linking identity: %s", err)
+		return usr, http.StatusInternalServerError, "Something went wrong"
+	}
+	return usr, 0, ""
+}
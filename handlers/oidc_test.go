@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DmitrijP/my-go-server/internal/oidc"
+	"github.com/DmitrijP/my-go-server/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// startOIDCLogin runs the login handler and returns the cookie it set
+// together with the state, nonce and code challenge sent to the provider.
+func startOIDCLogin(t *testing.T, cfg *ApiConfig) (*http.Cookie, url.Values) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	cfg.OIDCLoginHandler(rec, httptest.NewRequest(http.MethodGet, "/api/login/oidc", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login returned %d: %s", rec.Code, rec.Body.String())
+	}
+	redirect, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("bad redirect: %v", err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcCookieName {
+		t.Fatalf("login did not set the oidc cookie: %v", cookies)
+	}
+	return cookies[0], redirect.Query()
+}
+
+func oidcCallback(cfg *ApiConfig, cookie *http.Cookie, query url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/login/oidc/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	cfg.OIDCCallbackHandler(rec, req)
+	return rec
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	iss := oidctest.NewIssuer("chirpy", "secret")
+	defer iss.Close()
+	cfg := &ApiConfig{
+		BaseURL: "http://chirpy.test",
+		OIDC:    oidc.NewProvider(iss.URL, iss.ClientID, iss.ClientSecret, "http://chirpy.test/api/login/oidc/callback"),
+	}
+
+	tests := []struct {
+		name   string
+		claims func(claims jwt.MapClaims)
+		query  func(q url.Values)
+		noAuth bool
+		code   int
+	}{
+		{
+			name:   "missing cookie",
+			noAuth: true,
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:  "wrong state",
+			query: func(q url.Values) { q.Set("state", "forged") },
+			code:  http.StatusBadRequest,
+		},
+		{
+			name:   "wrong nonce",
+			claims: func(c jwt.MapClaims) { c["nonce"] = "replayed" },
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong issuer",
+			claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong audience",
+			claims: func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:  "provider error",
+			query: func(q url.Values) { q.Set("error", "access_denied") },
+			code:  http.StatusUnauthorized,
+		},
+		{
+			name:  "unknown code",
+			query: func(q url.Values) { q.Set("code", "unknown") },
+			code:  http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookie, sent := startOIDCLogin(t, cfg)
+			if sent.Get("state") == "" || sent.Get("nonce") == "" || sent.Get("code_challenge") == "" {
+				t.Fatalf("authorization request is incomplete: %v", sent)
+			}
+
+			claims := iss.Claims("alice", sent.Get("nonce"))
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			q := url.Values{}
+			q.Set("state", sent.Get("state"))
+			q.Set("code", iss.IssueCode(sent.Get("code_challenge"), claims))
+			if tt.query != nil {
+				tt.query(q)
+			}
+			if tt.noAuth {
+				cookie = nil
+			}
+
+			rec := oidcCallback(cfg, cookie, q)
+			if rec.Code != tt.code {
+				t.Errorf("callback returned %d, want %d: %s", rec.Code, tt.code, rec.Body.String())
+			}
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == sessionCookieName && c.MaxAge >= 0 {
+					t.Errorf("callback started a session")
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackStateIsBoundToCookie(t *testing.T) {
+	iss := oidctest.NewIssuer("chirpy", "secret")
+	defer iss.Close()
+	cfg := &ApiConfig{
+		BaseURL: "http://chirpy.test",
+		OIDC:    oidc.NewProvider(iss.URL, iss.ClientID, iss.ClientSecret, "http://chirpy.test/api/login/oidc/callback"),
+	}
+
+	// A callback started in another browser must not be accepted with the
+	// victim's cookie.
+	victimCookie, _ := startOIDCLogin(t, cfg)
+	_, attacker := startOIDCLogin(t, cfg)
+
+	q := url.Values{}
+	q.Set("state", attacker.Get("state"))
+	q.Set("code", iss.IssueCode(attacker.Get("code_challenge"), iss.Claims("mallory", attacker.Get("nonce"))))
+	rec := oidcCallback(cfg, victimCookie, q)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("callback returned %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
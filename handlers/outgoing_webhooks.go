@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/DmitrijP/my-go-server/internal/webhook"
+	"github.com/google/uuid"
+)
+
+const (
+	webhookOutboxCursor     = "webhooks"
+	webhookMaxAttempts      = 10
+	webhookMaxEndpoints     = 10
+	webhookDeliveryWorkers  = 4
+	deliveryStatusPending   = "pending"
+	deliveryStatusDelivered = "delivered"
+	deliveryStatusFailed    = "failed"
+)
+
+// outgoingWebhookEvents are the event types endpoints can subscribe to. They
+// are read from the outbox_events table. Endpoints of a user only get the
+// events of that user, endpoints registered by an admin get all of them.
+// user.mentioned and follow.created belong to the mentioned and the followed
+// user.
+var outgoingWebhookEvents = []string{
+	"chirp.created",
+	"chirp.deleted",
+	"user.mentioned",
+	"follow.created",
+	"user.deletion_scheduled",
+	"user.deletion_cancelled",
+	"user.deleted",
+}
+
+type webhook_endpoint_create struct {
+	Url    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type webhook_endpoint_model struct {
+	Id        string   `json:"id"`
+	CreatedAt string   `json:"created_at"`
+	Url       string   `json:"url"`
+	Events    []string `json:"events"`
+	// Secret is only returned when the endpoint is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+type webhook_delivery_model struct {
+	Id            string  `json:"id"`
+	CreatedAt     string  `json:"created_at"`
+	EventId       int64   `json:"event_id"`
+	EventType     string  `json:"event_type"`
+	Status        string  `json:"status"`
+	Attempts      int32   `json:"attempts"`
+	ResponseCode  *int32  `json:"response_code"`
+	Error         *string `json:"error"`
+	NextAttemptAt *string `json:"next_attempt_at"`
+	DeliveredAt   *string `json:"delivered_at"`
+}
+
+type webhook_payload struct {
+	Id        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func toWebhookEndpointModel(endpoint database.WebhookEndpoint) webhook_endpoint_model {
+	return webhook_endpoint_model{
+		Id:        endpoint.ID.String(),
+		CreatedAt: endpoint.CreatedAt.String(),
+		Url:       endpoint.Url,
+		Events:    strings.Fields(endpoint.Events),
+	}
+}
+
+func toWebhookDeliveryModel(delivery database.WebhookDelivery) webhook_delivery_model {
+	res := webhook_delivery_model{
+		Id:          delivery.ID.String(),
+		CreatedAt:   delivery.CreatedAt.String(),
+		EventId:     delivery.EventID,
+		EventType:   delivery.EventType,
+		Status:      delivery.Status,
+		Attempts:    delivery.Attempts,
+		DeliveredAt: nullTimeString(delivery.DeliveredAt),
+	}
+	if delivery.ResponseCode.Valid {
+		res.ResponseCode = &delivery.ResponseCode.Int32
+	}
+	if delivery.Error.Valid {
+		res.Error = &delivery.Error.String
+	}
+	if delivery.Status == deliveryStatusPending {
+		next := delivery.NextAttemptAt.String()
+		res.NextAttemptAt = &next
+	}
+	return res
+}
+
+func userOwner(req *http.Request) uuid.NullUUID {
+	return uuid.NullUUID{UUID: PrincipalFromContext(req.Context()).UserID, Valid: true}
+}
+
+func (cfg *ApiConfig) CreateWebhookEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.createWebhookEndpoint(w, req, userOwner(req))
+}
+
+func (cfg *ApiConfig) ListWebhookEndpointsHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.listWebhookEndpoints(w, req, userOwner(req))
+}
+
+func (cfg *ApiConfig) DeleteWebhookEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.deleteWebhookEndpoint(w, req, userOwner(req))
+}
+
+func (cfg *ApiConfig) ListWebhookDeliveriesHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.listWebhookDeliveries(w, req, userOwner(req))
+}
+
+// The admin variants manage the endpoints without an owner, which receive
+// the events of all users.
+
+func (cfg *ApiConfig) AdminCreateWebhookEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.createWebhookEndpoint(w, req, uuid.NullUUID{})
+}
+
+func (cfg *ApiConfig) AdminListWebhookEndpointsHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.listWebhookEndpoints(w, req, uuid.NullUUID{})
+}
+
+func (cfg *ApiConfig) AdminDeleteWebhookEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.deleteWebhookEndpoint(w, req, uuid.NullUUID{})
+}
+
+func (cfg *ApiConfig) AdminListWebhookDeliveriesHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.listWebhookDeliveries(w, req, uuid.NullUUID{})
+}
+
+func (cfg *ApiConfig) createWebhookEndpoint(w http.ResponseWriter, req *http.Request, owner uuid.NullUUID) {
+	w.Header().Set("Content-Type", "application/json")
+	params := webhook_endpoint_create{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	problems := map[string][]string{}
+	u, err := url.Parse(params.Url)
+	switch {
+	case err != nil || u.Host == "":
+		problems["url"] = append(problems["url"], "must be an absolute URL")
+	case u.Scheme != "https" && !(u.Scheme == "http" && cfg.WebhookAllowInsecure):
+		problems["url"] = append(problems["url"], "must use https")
+	}
+	if len(params.Events) == 0 {
+		problems["events"] = append(problems["events"], "must not be empty")
+	}
+	for _, event := range params.Events {
+		if !slices.Contains(outgoingWebhookEvents, event) {
+			problems["events"] = append(problems["events"], fmt.Sprintf("unknown event %q", event))
+		}
+	}
+	if len(problems) > 0 {
+		respondWithValidationErrors(w, problems)
+		return
+	}
+
+	endpoints, err := cfg.Db.ListWebhookEndpoints(req.Context(), owner)
+	if err != nil {
+		log.Printf("Error selecting webhook endpoints: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if len(endpoints) >= webhookMaxEndpoints {
+		respondWithError(w, http.StatusConflict, "Too many webhook endpoints")
+		return
+	}
+
+	secret, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating webhook secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	slices.Sort(params.Events)
+	endpoint, err := cfg.Db.CreateWebhookEndpoint(req.Context(), database.CreateWebhookEndpointParams{
+		UserID: owner,
+		Url:    params.Url,
+		Secret: "whsec_" + secret,
+		Events: strings.Join(slices.Compact(params.Events), " "),
+	})
+	if err != nil {
+		log.Printf("Error creating webhook endpoint: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	res := toWebhookEndpointModel(endpoint)
+	res.Secret = endpoint.Secret
+	respondWithJSON(w, http.StatusCreated, res)
+}
+
+func (cfg *ApiConfig) listWebhookEndpoints(w http.ResponseWriter, req *http.Request, owner uuid.NullUUID) {
+	w.Header().Set("Content-Type", "application/json")
+	endpoints, err := cfg.Db.ListWebhookEndpoints(req.Context(), owner)
+	if err != nil {
+		log.Printf("Error selecting webhook endpoints: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	res := make([]webhook_endpoint_model, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		res = append(res, toWebhookEndpointModel(endpoint))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (cfg *ApiConfig) deleteWebhookEndpoint(w http.ResponseWriter, req *http.Request, owner uuid.NullUUID) {
+	w.Header().Set("Content-Type", "application/json")
+	endpointId, err := uuid.Parse(req.PathValue("endpointID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Webhook endpoint not found")
+		return
+	}
+	deleted, err := cfg.Db.DeleteWebhookEndpoint(req.Context(), database.DeleteWebhookEndpointParams{ID: endpointId, UserID: owner})
+	if err != nil {
+		log.Printf("Error deleting webhook endpoint: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Webhook endpoint not found")
+		return
+	}
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) listWebhookDeliveries(w http.ResponseWriter, req *http.Request, owner uuid.NullUUID) {
+	w.Header().Set("Content-Type", "application/json")
+	endpointId, err := uuid.Parse(req.PathValue("endpointID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Webhook endpoint not found")
+		return
+	}
+	endpoint, err := cfg.Db.GetWebhookEndpoint(req.Context(), endpointId)
+	if err != nil || endpoint.UserID != owner {
+		respondWithError(w, http.StatusNotFound, "Webhook endpoint not found")
+		return
+	}
+
+	deliveries, err := cfg.Db.ListWebhookDeliveries(req.Context(), database.ListWebhookDeliveriesParams{EndpointID: endpoint.ID, Limit: 100})
+	if err != nil {
+		log.Printf("Error selecting webhook deliveries: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	res := make([]webhook_delivery_model, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		res = append(res, toWebhookDeliveryModel(delivery))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// RunWebhookDeliveries turns new outbox events into deliveries and sends
+// them until ctx is done. Deliveries live in the database, so pending ones
+// survive a restart, and several replicas can run this side by side.
+func (cfg *ApiConfig) RunWebhookDeliveries(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cfg.dispatchOutboxEvents(ctx)
+
+		var wg sync.WaitGroup
+		for range webhookDeliveryWorkers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for cfg.deliverNextWebhook(ctx) {
+				}
+			}()
+		}
+		wg.Wait()
+
+		cfg.purgeOrphanedWebhookEndpoints(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchOutboxEvents creates a delivery for every endpoint subscribed to
+// an event after the cursor. Deliveries are unique per endpoint and event, so
+// a replica running the same batch concurrently does no harm.
+func (cfg *ApiConfig) dispatchOutboxEvents(ctx context.Context) {
+	for {
+		lastId, err := cfg.Db.GetOutboxCursor(ctx, webhookOutboxCursor)
+		if err != nil {
+			log.Printf("Error selecting outbox cursor: %s", err)
+			return
+		}
+		events, err := cfg.Db.ListOutboxEventsAfter(ctx, database.ListOutboxEventsAfterParams{ID: lastId, Limit: 100})
+		if err != nil {
+			log.Printf("Error selecting outbox events: %s", err)
+			return
+		}
+		if len(events) == 0 {
+			return
+		}
+		for _, event := range events {
+			_, err = cfg.Db.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+				EventID:   event.ID,
+				EventType: event.Type,
+				Payload:   event.Payload,
+				UserID:    event.UserID,
+			})
+			if err != nil {
+				log.Printf("Error enqueueing webhook deliveries: %s", err)
+				return
+			}
+			err = cfg.Db.UpdateOutboxCursor(ctx, database.UpdateOutboxCursorParams{Name: webhookOutboxCursor, LastID: event.ID})
+			if err != nil {
+				log.Printf("Error updating outbox cursor: %s", err)
+				return
+			}
+		}
+	}
+}
+
+// purgeOrphanedWebhookEndpoints removes the endpoints of deleted users. They
+// are kept after the account is gone until the user.deleted event has been
+// dispatched and every delivery to them has finished.
+func (cfg *ApiConfig) purgeOrphanedWebhookEndpoints(ctx context.Context) {
+	n, err := cfg.Db.DeleteOrphanedWebhookEndpoints(ctx, webhookOutboxCursor)
+	if err != nil {
+		log.Printf("Error deleting webhook endpoints of deleted users: %s", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Deleted %d webhook endpoints of deleted users", n)
+	}
+}
+
+// deliverNextWebhook sends one due delivery. It reports whether there was
+// one, so the caller keeps going until the queue is drained.
+func (cfg *ApiConfig) deliverNextWebhook(ctx context.Context) bool {
+	delivery, err := cfg.Db.ClaimWebhookDelivery(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Error claiming webhook delivery: %s", err)
+		return false
+	}
+
+	code, err := cfg.sendWebhook(ctx, delivery)
+	responseCode := sql.NullInt32{Int32: int32(code), Valid: code != 0}
+	if err == nil {
+		err = cfg.Db.CompleteWebhookDelivery(ctx, database.CompleteWebhookDeliveryParams{ID: delivery.ID, ResponseCode: responseCode})
+		if err != nil {
+			log.Printf("Error updating webhook delivery: %s", err)
+		}
+		return true
+	}
+
+	// The next attempt is scheduled by the database: the wait doubles after
+	// every failed attempt, starting at 30 seconds and capped at 12 hours.
+	params := database.RetryWebhookDeliveryParams{
+		ID:           delivery.ID,
+		Status:       deliveryStatusPending,
+		ResponseCode: responseCode,
+		Error:        sql.NullString{String: err.Error(), Valid: true},
+	}
+	if delivery.Attempts >= webhookMaxAttempts {
+		params.Status = deliveryStatusFailed
+	}
+	err = cfg.Db.RetryWebhookDelivery(ctx, params)
+	if err != nil {
+		log.Printf("Error updating webhook delivery: %s", err)
+	}
+	return true
+}
+
+// sendWebhook posts a delivery to its endpoint and returns the response
+// code. Anything but a 2xx answer is an error. The Webhook-Id header stays
+// the same across retries, so receivers can drop duplicates.
+func (cfg *ApiConfig) sendWebhook(ctx context.Context, delivery database.WebhookDelivery) (int, error) {
+	endpoint, err := cfg.Db.GetWebhookEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(webhook_payload{
+		Id:        delivery.EventID,
+		Type:      delivery.EventType,
+		CreatedAt: delivery.CreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set("Webhook-Id", delivery.ID.String())
+	req.Header.Set(webhook.TimestampHeader, fmt.Sprint(now.Unix()))
+	req.Header.Set(webhook.SignatureHeader, webhook.SignatureHeaderValue(webhook.Sign([]byte(endpoint.Secret), now, body)))
+
+	resp, err := cfg.WebhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/DmitrijP/my-go-server/internal/webauthn"
+	"github.com/google/uuid"
+)
+
+const (
+	passkeyChallengeTTL = 5 * time.Minute
+	ceremonyRegister    = "register"
+	ceremonyLogin       = "login"
+)
+
+type passkey_options struct {
+	SessionId string `json:"session_id"`
+	PublicKey any    `json:"publicKey"`
+}
+
+type passkey_register struct {
+	SessionId  string                        `json:"session_id"`
+	Name       string                        `json:"name"`
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+type passkey_login struct {
+	SessionId  string                     `json:"session_id"`
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+type passkey_model struct {
+	Id           string  `json:"id"`
+	CreatedAt    string  `json:"created_at"`
+	Name         string  `json:"name"`
+	CredentialId string  `json:"credential_id"`
+	LastUsedAt   *string `json:"last_used_at"`
+}
+
+func (cfg *ApiConfig) PasskeyRegisterBeginHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	usr, err := cfg.Db.SelectUserById(req.Context(), userId)
+	if err != nil {
+		log.Printf("Error selecting usr: %s", err)
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	creds, err := cfg.Db.ListWebAuthnCredentials(req.Context(), userId)
+	if err != nil {
+		log.Printf("Error selecting passkeys: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	exclude := [][]byte{}
+	for _, cred := range creds {
+		exclude = append(exclude, cred.CredentialID)
+	}
+
+	session, challenge, ok := cfg.startPasskeyCeremony(w, req, ceremonyRegister, uuid.NullUUID{UUID: userId, Valid: true})
+	if !ok {
+		return
+	}
+	user := webauthn.User{ID: usr.ID[:], Name: usr.Email, DisplayName: usr.Email}
+	respondWithJSON(w, http.StatusOK, passkey_options{
+		SessionId: session.String(),
+		PublicKey: cfg.WebAuthn.CreationOptions(challenge, user, exclude),
+	})
+}
+
+func (cfg *ApiConfig) PasskeyRegisterFinishHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(req.Body)
+	params := passkey_register{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+	if strings.TrimSpace(params.Name) == "" {
+		respondWithValidationErrors(w, map[string][]string{"name": {"must not be empty"}})
+		return
+	}
+
+	challenge, ok := cfg.takePasskeyChallenge(w, req, params.SessionId, ceremonyRegister)
+	if !ok {
+		return
+	}
+	if challenge.UserID.UUID != userId {
+		respondWithError(w, http.StatusBadRequest, "Passkey session invalid or expired")
+		return
+	}
+
+	cred, err := cfg.WebAuthn.VerifyRegistration(params.Credential, challenge.Challenge)
+	if err != nil {
+		log.Printf("Error verifying passkey registration: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Passkey registration failed")
+		return
+	}
+
+	passkey, err := cfg.Db.CreateWebAuthnCredential(req.Context(), database.CreateWebAuthnCredentialParams{
+		Name:         params.Name,
+		CredentialID: cred.ID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    int64(cred.SignCount),
+		UserID:       userId,
+	})
+	if err != nil {
+		log.Printf("Error saving passkey: %s", err)
+		respondWithError(w, http.StatusConflict, "Passkey may already be registered")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, toPasskeyModel(passkey))
+}
+
+func (cfg *ApiConfig) ListPasskeysHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	creds, err := cfg.Db.ListWebAuthnCredentials(req.Context(), userId)
+	if err != nil {
+		log.Printf("Error selecting passkeys: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	passkey_models := []passkey_model{}
+	for _, cred := range creds {
+		passkey_models = append(passkey_models, toPasskeyModel(cred))
+	}
+	respondWithJSON(w, http.StatusOK, passkey_models)
+}
+
+func (cfg *ApiConfig) DeletePasskeyHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	passkeyUuid, err := uuid.Parse(req.PathValue("passkeyID"))
+	if err != nil {
+		log.Printf("Error parsing passkey id: %s", err)
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	deleted, err := cfg.Db.DeleteWebAuthnCredential(req.Context(), database.DeleteWebAuthnCredentialParams{ID: passkeyUuid, UserID: userId})
+	if err != nil {
+		log.Printf("Error deleting passkey: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Passkey not found")
+		return
+	}
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) PasskeyLoginBeginHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ip := clientIP(req, cfg.TrustedProxies)
+	retryAfter, err := cfg.CeremonyLimiter.RetryAfterIP(req.Context(), ip)
+	if err != nil {
+		log.Printf("Error checking passkey attempts: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many passkey login attempts")
+		return
+	}
+	err = cfg.CeremonyLimiter.AttemptedIP(req.Context(), ip)
+	if err != nil {
+		log.Printf("Error recording passkey attempt: %s", err)
+	}
+
+	session, challenge, ok := cfg.startPasskeyCeremony(w, req, ceremonyLogin, uuid.NullUUID{})
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, passkey_options{
+		SessionId: session.String(),
+		PublicKey: cfg.WebAuthn.RequestOptions(challenge),
+	})
+}
+
+// PasskeyLoginFinishHandler verifies the assertion and answers like
+// LoginHandler. The credential id alone identifies the user, so passkeys work
+// without entering an email address.
+func (cfg *ApiConfig) PasskeyLoginFinishHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(req.Body)
+	params := passkey_login{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	challenge, ok := cfg.takePasskeyChallenge(w, req, params.SessionId, ceremonyLogin)
+	if !ok {
+		return
+	}
+
+	passkey, err := cfg.Db.GetWebAuthnCredential(req.Context(), params.Credential.RawID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error selecting passkey: %s", err)
+		}
+		respondWithError(w, http.StatusUnauthorized, "Unknown passkey")
+		return
+	}
+
+	cred := webauthn.Credential{
+		ID:        passkey.CredentialID,
+		PublicKey: passkey.PublicKey,
+		SignCount: uint32(passkey.SignCount),
+	}
+	count, err := cfg.WebAuthn.VerifyAssertion(params.Credential, challenge.Challenge, cred)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrClonedAuthenticator) {
+			log.Printf("Possibly cloned passkey %s of user %s: counter %d", passkey.ID, passkey.UserID, passkey.SignCount)
+		} else {
+			log.Printf("Error verifying passkey assertion: %s", err)
+		}
+		respondWithError(w, http.StatusUnauthorized, "Passkey login failed")
+		return
+	}
+
+	// The counter only moves forward in the database as well. Two logins
+	// racing with the same counter value can not both succeed.
+	updated, err := cfg.Db.UpdateWebAuthnSignCount(req.Context(), database.UpdateWebAuthnSignCountParams{ID: passkey.ID, SignCount: int64(count)})
+	if err != nil {
+		log.Printf("Error updating passkey: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if updated == 0 {
+		log.Printf("Possibly cloned passkey %s of user %s: counter %d already used", passkey.ID, passkey.UserID, count)
+		respondWithError(w, http.StatusUnauthorized, "Passkey login failed")
+		return
+	}
+
+	usr, err := cfg.Db.SelectUserById(req.Context(), passkey.UserID)
+	if err != nil {
+		log.Printf("Error selecting usr: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Passkey login failed")
+		return
+	}
+	cfg.issueSession(w, req, usr, wantsCookieSession(req))
+}
+
+func (cfg *ApiConfig) startPasskeyCeremony(w http.ResponseWriter, req *http.Request, ceremony string, userId uuid.NullUUID) (uuid.UUID, string, bool) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		log.Printf("Error creating passkey challenge: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return uuid.Nil, "", false
+	}
+	session, err := cfg.Db.CreateWebAuthnChallenge(req.Context(), database.CreateWebAuthnChallengeParams{
+		ExpiresAt: time.Now().Add(passkeyChallengeTTL),
+		Ceremony:  ceremony,
+		Challenge: challenge,
+		UserID:    userId,
+	})
+	if err != nil {
+		log.Printf("Error saving passkey challenge: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return uuid.Nil, "", false
+	}
+	return session.ID, challenge, true
+}
+
+// takePasskeyChallenge deletes the challenge while reading it, so every
+// challenge can only be answered once.
+func (cfg *ApiConfig) takePasskeyChallenge(w http.ResponseWriter, req *http.Request, sessionId, ceremony string) (database.WebauthnChallenge, bool) {
+	id, err := uuid.Parse(sessionId)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Passkey session invalid or expired")
+		return database.WebauthnChallenge{}, false
+	}
+	challenge, err := cfg.Db.TakeWebAuthnChallenge(req.Context(), database.TakeWebAuthnChallengeParams{ID: id, Ceremony: ceremony})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error selecting passkey challenge: %s", err)
+		}
+		respondWithError(w, http.StatusBadRequest, "Passkey session invalid or expired")
+		return database.WebauthnChallenge{}, false
+	}
+	return challenge, true
+}
+
+func toPasskeyModel(cred database.WebauthnCredential) passkey_model {
+	return passkey_model{
+		Id:           cred.ID.String(),
+		CreatedAt:    cred.CreatedAt.String(),
+		Name:         cred.Name,
+		CredentialId: base64.RawURLEncoding.EncodeToString(cred.CredentialID),
+		LastUsedAt:   nullTimeString(cred.LastUsedAt),
+	}
+}
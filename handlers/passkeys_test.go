@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DmitrijP/my-go-server/internal/lockout"
+)
+
+func TestPasskeyLoginBeginIsRateLimited(t *testing.T) {
+	cfg := &ApiConfig{CeremonyLimiter: lockout.NewCeremonyLimiter(lockout.NewMemoryStore())}
+	for range cfg.CeremonyLimiter.IP.FreeAttempts + 1 {
+		err := cfg.CeremonyLimiter.AttemptedIP(context.Background(), "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login/passkey/begin", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	cfg.PasskeyLoginBeginHandler(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("got %d, want %d: %s", rec.Code, http.StatusTooManyRequests, rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Retry-After header missing")
+	}
+}
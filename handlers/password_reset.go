@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/DmitrijP/my-go-server/internal/mail"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+type password_reset_request struct {
+	Email string `json:"email"`
+}
+
+type password_reset_confirm struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (cfg *ApiConfig) PasswordResetRequestHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(req.Body)
+	params := password_reset_request{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	// The response is the same whether the email is known or not, so the
+	// endpoint can not be used to find out which accounts exist.
+	usr, err := cfg.Db.SelectUserByEmail(req.Context(), params.Email)
+	if err != nil {
+		log.Printf("Password reset requested for unknown email: %s", err)
+		respondWithoutBody(w, http.StatusAccepted)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating reset token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	tkParams := database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+		UserID:    usr.ID,
+	}
+	_, err = cfg.Db.CreatePasswordResetToken(req.Context(), tkParams)
+	if err != nil {
+		log.Printf("Error saving reset token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	msg := mail.Message{
+		To:      usr.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"Open the link below within %d minutes to choose a new password:\n\n%s/app/reset-password.html?token=%s\n\n"+
+			"If this was not you, you can ignore this email.",
+			int(passwordResetTTL.Minutes()), cfg.BaseURL, token),
+	}
+	cfg.sendMail(msg)
+
+	respondWithoutBody(w, http.StatusAccepted)
+}
+
+func (cfg *ApiConfig) PasswordResetConfirmHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(req.Body)
+	params := password_reset_confirm{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	tok, err := cfg.Db.GetPasswordResetToken(req.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		log.Printf("Error selecting reset token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Reset token invalid or expired")
+		return
+	}
+
+	usr, err := cfg.Db.SelectUserById(req.Context(), tok.UserID)
+	if err != nil {
+		log.Printf("Error selecting usr: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Reset token invalid or expired")
+		return
+	}
+	if problems := cfg.PasswordPolicy.Check(params.Password, usr.Email); len(problems) > 0 {
+		respondWithValidationErrors(w, map[string][]string{"password": problems})
+		return
+	}
+
+	hpass, err := auth.HashPassword(params.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	// Marking the token used only succeeds once, and only before it expires.
+	used, err := cfg.Db.UsePasswordResetToken(req.Context(), tok.TokenHash)
+	if err != nil || used != 1 {
+		log.Printf("Reset token already used or expired: %v", err)
+		respondWithError(w, http.StatusBadRequest, "Reset token invalid or expired")
+		return
+	}
+
+	err = cfg.Db.UpdatePassword(req.Context(), database.UpdatePasswordParams{ID: tok.UserID, HashedPassword: hpass})
+	if err != nil {
+		log.Printf("Error updating password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	err = cfg.Db.DeletePasswordResetTokensForUser(req.Context(), tok.UserID)
+	if err != nil {
+		log.Printf("Error deleting reset tokens: %s", err)
+	}
+	err = cfg.invalidateSessions(req.Context(), tok.UserID)
+	if err != nil {
+		log.Printf("Error invalidating sessions: %s", err)
+	}
+
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) sendMail(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		err := cfg.Mailer.Send(ctx, msg)
+		if err != nil {
+			log.Printf("Error sending mail: %s", err)
+		}
+	}()
+}
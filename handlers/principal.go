@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	TokenTypeSession     = "session"
+	TokenTypeAccessToken = "access_token"
+	TokenTypeOAuth       = "oauth"
+)
+
+// Principal is the authenticated caller of a request. Session tokens carry
+// the full rights of the user, personal access tokens and OAuth tokens only
+// the scopes they were issued with.
+type Principal struct {
+	UserID    uuid.UUID
+	Role      string
+	Scopes    []string
+	TokenType string
+	// TokenID and ExpiresAt are only set for JWTs, AuthTime only for JWTs
+	// issued at a login.
+	TokenID   string
+	ExpiresAt time.Time
+	AuthTime  time.Time
+}
+
+func (p Principal) IsAuthenticated() bool {
+	return p.UserID != uuid.Nil
+}
+
+func (p Principal) HasScope(scope string) bool {
+	if p.TokenType == TokenTypeSession {
+		return true
+	}
+	return auth.HasScope(p.Scopes, scope)
+}
+
+var errSuspended = errors.New("account suspended")
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the caller stored by RequireAuth or
+// OptionalAuth. Without one it returns the zero Principal, which is not
+// authenticated.
+func PrincipalFromContext(ctx context.Context) Principal {
+	p, _ := ctx.Value(principalKey{}).(Principal)
+	return p
+}
+
+// resolvePrincipal authenticates the token of a request. It returns
+// errNoToken if the request carries none.
+func (cfg *ApiConfig) resolvePrincipal(req *http.Request) (Principal, error) {
+	token, err := requestToken(req)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	var p Principal
+	var usr database.User
+	if auth.IsPersonalAccessToken(token) {
+		pat, err := cfg.Db.GetPersonalAccessTokenByHash(req.Context(), auth.HashToken(token))
+		if err != nil {
+			return Principal{}, err
+		}
+		if pat.RevokedAt.Valid || (pat.ExpiresAt.Valid && pat.ExpiresAt.Time.Before(time.Now())) {
+			return Principal{}, errors.New("access token expired or revoked")
+		}
+		err = cfg.Db.TouchPersonalAccessToken(req.Context(), pat.ID)
+		if err != nil {
+			log.Printf("Error updating access token usage: %s", err)
+		}
+		usr, err = cfg.Db.SelectUserById(req.Context(), pat.UserID)
+		if err != nil {
+			return Principal{}, err
+		}
+		p = Principal{UserID: pat.UserID, Scopes: auth.ParseScopes(pat.Scopes), TokenType: TokenTypeAccessToken}
+	} else {
+		var claims *auth.Claims
+		claims, usr, err = cfg.validateJWT(req.Context(), token)
+		if err != nil {
+			return Principal{}, err
+		}
+		p = Principal{UserID: usr.ID, TokenType: TokenTypeSession, TokenID: claims.ID}
+		if claims.ExpiresAt != nil {
+			p.ExpiresAt = claims.ExpiresAt.Time
+		}
+		if claims.AuthTime != nil {
+			p.AuthTime = claims.AuthTime.Time
+		}
+		if claims.ClientID != "" {
+			p.TokenType = TokenTypeOAuth
+			p.Scopes = auth.ParseScopes(claims.Scope)
+		}
+	}
+
+	if usr.SuspendedAt.Valid {
+		return Principal{}, errSuspended
+	}
+	p.Role = usr.Role
+	return p, nil
+}
+
+// validateJWT is auth.ParseJWT plus the revocation check, which rejects
+// tokens revoked by their jti or issued before the last security event of
+// the user. The time of that event is read from the user row, which is
+// returned as well.
+func (cfg *ApiConfig) validateJWT(ctx context.Context, token string) (*auth.Claims, database.User, error) {
+	claims, err := auth.ParseJWT(token, cfg.JwtKeys)
+	if err != nil {
+		return nil, database.User{}, err
+	}
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, database.User{}, fmt.Errorf("invalid user ID in token: %v", err)
+	}
+	if claims.IssuedAt == nil {
+		return nil, database.User{}, fmt.Errorf("token without issue time")
+	}
+	usr, err := cfg.Db.SelectUserById(ctx, id)
+	if err != nil {
+		return nil, database.User{}, err
+	}
+	err = cfg.Revocations.CheckToken(ctx, claims.ID, claims.IssuedAt.Time, usr.TokensValidAfter.Time)
+	if err != nil {
+		return nil, database.User{}, err
+	}
+	return claims, usr, nil
+}
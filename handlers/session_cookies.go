@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+)
+
+var (
+	errNoToken      = errors.New("No authorization Token")
+	errCSRFMismatch = errors.New("CSRF token missing or invalid")
+)
+
+const (
+	sessionCookieName = "chirpy_session"
+	refreshCookieName = "chirpy_refresh"
+	csrfCookieName    = "chirpy_csrf"
+	csrfHeaderName    = "X-CSRF-Token"
+)
+
+// wantsCookieSession reports whether a login asked for the cookie session
+// mode with ?session=cookie. The browser app under /app/ uses it so tokens
+// never have to be readable from JavaScript.
+func wantsCookieSession(req *http.Request) bool {
+	return req.URL.Query().Get("session") == "cookie"
+}
+
+// setSessionCookies stores the tokens in HttpOnly cookies. The CSRF cookie is
+// readable by the app, which echoes it in the X-CSRF-Token header
+// (double-submit) on every request that changes something.
+func (cfg *ApiConfig) setSessionCookies(w http.ResponseWriter, access, refresh string, accessTTL, refreshTTL time.Duration) error {
+	csrf, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    access,
+		Path:     "/",
+		MaxAge:   int(accessTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.secureCookies(),
+		SameSite: http.SameSiteStrictMode,
+	})
+	if refresh != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     refreshCookieName,
+			Value:    refresh,
+			Path:     "/api/",
+			MaxAge:   int(refreshTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   cfg.secureCookies(),
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    csrf,
+		Path:     "/",
+		MaxAge:   int(refreshTTL.Seconds()),
+		Secure:   cfg.secureCookies(),
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+func (cfg *ApiConfig) clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: "/", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: refreshCookieName, Path: "/api/", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: csrfCookieName, Path: "/", MaxAge: -1})
+}
+
+func checkCSRF(req *http.Request) error {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	cookie, err := req.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return errCSRFMismatch
+	}
+	header := req.Header.Get(csrfHeaderName)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return errCSRFMismatch
+	}
+	return nil
+}
+
+// requestToken returns the access token of a request. An Authorization
+// header wins, otherwise the session cookie is used, which additionally
+// needs a valid CSRF token for state changing requests.
+func requestToken(req *http.Request) (string, error) {
+	return tokenFromRequest(req, sessionCookieName)
+}
+
+func requestRefreshToken(req *http.Request) (string, bool, error) {
+	if req.Header.Get("Authorization") != "" {
+		token, err := auth.GetBearerToken(req.Header)
+		return token, false, err
+	}
+	token, err := tokenFromRequest(req, refreshCookieName)
+	return token, true, err
+}
+
+func tokenFromRequest(req *http.Request, cookieName string) (string, error) {
+	if req.Header.Get("Authorization") != "" {
+		return auth.GetBearerToken(req.Header)
+	}
+	cookie, err := req.Cookie(cookieName)
+	if err != nil {
+		return "", errNoToken
+	}
+	err = checkCSRF(req)
+	if err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	planChirpyRed = "chirpy_red"
+
+	subscriptionActive   = "active"
+	subscriptionPastDue  = "past_due"
+	subscriptionCanceled = "canceled"
+)
+
+// subscriptionIsActive reports whether sub grants its plan at now. A failed
+// payment keeps the plan until the paid period ends, and so does a
+// cancellation at the end of the period. An active subscription without a
+// period end runs until it is cancelled, a past due one without a period end
+// has nothing left to run out and ends at once.
+func subscriptionIsActive(sub database.Subscription, now time.Time) bool {
+	switch sub.Status {
+	case subscriptionActive:
+		return !sub.CurrentPeriodEnd.Valid || sub.CurrentPeriodEnd.Time.After(now)
+	case subscriptionPastDue:
+		return sub.CurrentPeriodEnd.Valid && sub.CurrentPeriodEnd.Time.After(now)
+	}
+	return false
+}
+
+func (cfg *ApiConfig) isChirpyRed(ctx context.Context, userId uuid.UUID) (bool, error) {
+	sub, err := cfg.Db.GetSubscription(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return sub.Plan == planChirpyRed && subscriptionIsActive(sub, time.Now()), nil
+}
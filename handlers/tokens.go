@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+type token_create struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type token_model struct {
+	Id         string   `json:"id"`
+	CreatedAt  string   `json:"created_at"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  *string  `json:"expires_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+	RevokedAt  *string  `json:"revoked_at"`
+	Token      string   `json:"token,omitempty"`
+}
+
+func (cfg *ApiConfig) CreateTokenHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(req.Body)
+	params := token_create{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error decoding parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	fields := map[string][]string{}
+	if strings.TrimSpace(params.Name) == "" {
+		fields["name"] = append(fields["name"], "must not be empty")
+	}
+	if len(params.Scopes) == 0 {
+		fields["scopes"] = append(fields["scopes"], "must contain at least one scope")
+	}
+	for _, scope := range params.Scopes {
+		if !auth.IsKnownScope(scope) {
+			fields["scopes"] = append(fields["scopes"], "unknown scope "+scope)
+		}
+	}
+	if params.ExpiresInDays < 0 {
+		fields["expires_in_days"] = append(fields["expires_in_days"], "must not be negative")
+	}
+	if len(fields) > 0 {
+		respondWithValidationErrors(w, fields)
+		return
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		log.Printf("Error creating access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	var expiresAt sql.NullTime
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+	}
+
+	pat, err := cfg.Db.CreatePersonalAccessToken(req.Context(), database.CreatePersonalAccessTokenParams{
+		Name:      params.Name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    strings.Join(params.Scopes, " "),
+		ExpiresAt: expiresAt,
+		UserID:    userId,
+	})
+	if err != nil {
+		log.Printf("Error saving access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	// The plain token is only ever shown in this response.
+	res := toTokenModel(pat)
+	res.Token = token
+	respondWithJSON(w, http.StatusCreated, res)
+}
+
+func (cfg *ApiConfig) ListTokensHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	pats, err := cfg.Db.ListPersonalAccessTokens(req.Context(), userId)
+	if err != nil {
+		log.Printf("Error selecting access tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	token_models := []token_model{}
+	for _, pat := range pats {
+		token_models = append(token_models, toTokenModel(pat))
+	}
+	respondWithJSON(w, http.StatusOK, token_models)
+}
+
+func (cfg *ApiConfig) RevokeTokenHandler(w http.ResponseWriter, req *http.Request) {
+	userId := PrincipalFromContext(req.Context()).UserID
+
+	w.Header().Set("Content-Type", "application/json")
+	tokenUuid, err := uuid.Parse(req.PathValue("tokenID"))
+	if err != nil {
+		log.Printf("Error parsing token id: %s", err)
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	revoked, err := cfg.Db.RevokePersonalAccessToken(req.Context(), database.RevokePersonalAccessTokenParams{ID: tokenUuid, UserID: userId})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error revoking access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Access token not found")
+		return
+	}
+	respondWithoutBody(w, http.StatusNoContent)
+}
+
+func toTokenModel(pat database.PersonalAccessToken) token_model {
+	return token_model{
+		Id:         pat.ID.String(),
+		CreatedAt:  pat.CreatedAt.String(),
+		Name:       pat.Name,
+		Scopes:     auth.ParseScopes(pat.Scopes),
+		ExpiresAt:  nullTimeString(pat.ExpiresAt),
+		LastUsedAt: nullTimeString(pat.LastUsedAt),
+		RevokedAt:  nullTimeString(pat.RevokedAt),
+	}
+}
+
+func nullTimeString(t sql.NullTime) *string {
+	if !t.Valid {
+		return nil
+	}
+	s := t.Time.String()
+	return &s
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+type webhook_event_model struct {
+	Id          string          `json:"id"`
+	Provider    string          `json:"provider"`
+	EventId     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Status      string          `json:"status"`
+	Error       *string         `json:"error"`
+	Attempts    int32           `json:"attempts"`
+	CreatedAt   string          `json:"created_at"`
+	ProcessedAt *string         `json:"processed_at"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+func toWebhookEventModel(event database.WebhookEvent) webhook_event_model {
+	res := webhook_event_model{
+		Id:          event.ID.String(),
+		Provider:    event.Provider,
+		EventId:     event.EventID,
+		EventType:   event.EventType,
+		Status:      event.Status,
+		Attempts:    event.Attempts,
+		CreatedAt:   event.CreatedAt.String(),
+		ProcessedAt: nullTimeString(event.ProcessedAt),
+		Payload:     event.Payload,
+	}
+	if event.Error.Valid {
+		res.Error = &event.Error.String
+	}
+	return res
+}
+
+// ListWebhookEventsHandler shows the newest incoming webhook events with the
+// given status, failed ones unless ?status= says otherwise.
+func (cfg *ApiConfig) ListWebhookEventsHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	status := req.URL.Query().Get("status")
+	if status == "" {
+		status = webhookStatusFailed
+	}
+	limit := 100
+	if v := req.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	events, err := cfg.Db.ListWebhookEvents(req.Context(), database.ListWebhookEventsParams{Status: status, Limit: int32(limit)})
+	if err != nil {
+		log.Printf("Error selecting webhook events: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	res := make([]webhook_event_model, 0, len(events))
+	for _, event := range events {
+		res = append(res, toWebhookEventModel(event))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// ReplayWebhookEventHandler processes a failed event again from its stored
+// payload, for example after the cause of the failure was fixed. Events still
+// in received five minutes after their last attempt count as failed, their
+// processing was interrupted.
+func (cfg *ApiConfig) ReplayWebhookEventHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	eventId, err := uuid.Parse(req.PathValue("eventID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Failed or stuck event not found")
+		return
+	}
+
+	event, err := cfg.Db.ReplayWebhookEvent(req.Context(), eventId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Failed or stuck event not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error selecting webhook event: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	// The outcome is part of the response, a failed replay is not an error
+	// of this request.
+	_ = cfg.processWebhookEvent(req.Context(), &event)
+	respondWithJSON(w, http.StatusOK, toWebhookEventModel(event))
+}
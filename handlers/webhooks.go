@@ -1,70 +1,257 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/DmitrijP/my-go-server/internal/auth"
 	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/DmitrijP/my-go-server/internal/webhook"
 	"github.com/google/uuid"
 )
 
 type polka_event struct {
+	Id    string    `json:"id"`
 	Event string    `json:"event"`
 	Data  user_data `json:"data"`
+	// CreatedAt is when Polka raised the event. It orders events that are
+	// delivered out of order.
+	CreatedAt *time.Time `json:"created_at"`
 }
 
 type user_data struct {
 	UserId string `json:"user_id"`
+	// The fields below are only sent with subscription events.
+	Plan              string     `json:"plan"`
+	CurrentPeriodEnd  *time.Time `json:"current_period_end"`
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end"`
 }
 
+const (
+	webhookProviderPolka = "polka"
+
+	webhookStatusProcessed = "processed"
+	webhookStatusIgnored   = "ignored"
+	webhookStatusFailed    = "failed"
+)
+
+var errWebhookUserNotFound = errors.New("user not found")
+
 func (cfg *ApiConfig) PolkaWebhookHandler(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	key, err := auth.GetAPIKey(req.Header)
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, 1<<20))
 	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Something went wrong")
+		log.Printf("Error reading webhook body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
 		return
 	}
 
-	if key != cfg.PolkaKey {
-		log.Printf("Error decoding parameters: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Wrong API KEY")
+	if !cfg.verifyPolkaRequest(w, req, body) {
 		return
 	}
 
-	decoder := json.NewDecoder(req.Body)
 	params := polka_event{}
-	err = decoder.Decode(&params)
+	err = json.Unmarshal(body, &params)
 	if err != nil {
 		log.Printf("Error decoding parameters: %s", err)
-		respondWithError(w, http.StatusNoContent, "Something went wrong")
+		respondWithError(w, http.StatusBadRequest, "Malformed event")
 		return
 	}
 
-	if params.Event != "user.upgraded" {
+	// Deliveries without an id are identified by their content, so a retry of
+	// the same body is still recognized.
+	eventId := params.Id
+	if eventId == "" {
+		sum := sha256.Sum256(body)
+		eventId = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	// Events seen before are only processed again if they failed last time
+	// or were left in received for more than five minutes by a crash.
+	event, err := cfg.Db.RecordWebhookEvent(req.Context(), database.RecordWebhookEventParams{
+		Provider:  webhookProviderPolka,
+		EventID:   eventId,
+		EventType: params.Event,
+		Payload:   body,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
 		respondWithoutBody(w, http.StatusNoContent)
 		return
 	}
-	uid, err := uuid.Parse(params.Data.UserId)
 	if err != nil {
-		respondWithoutBody(w, http.StatusNoContent)
+		log.Printf("Error recording webhook event: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
-	updtUsr, err := cfg.Db.SelectUserById(req.Context(), uid)
-	if err != nil {
-		log.Printf("Error selecting usr: %s", err)
+
+	err = cfg.processWebhookEvent(req.Context(), &event)
+	switch {
+	case errors.Is(err, errWebhookUserNotFound):
 		respondWithError(w, http.StatusNotFound, err.Error())
-		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+	default:
+		respondWithoutBody(w, http.StatusNoContent)
 	}
-	p := database.UpdateChirpyRedParams{ID: updtUsr.ID, IsChirpyRed: true}
-	err = cfg.Db.UpdateChirpyRed(req.Context(), p)
+}
+
+// processWebhookEvent runs a recorded event and stores the outcome in the
+// ledger. Failed events stay there to be inspected and replayed.
+func (cfg *ApiConfig) processWebhookEvent(ctx context.Context, event *database.WebhookEvent) error {
+	status, err := cfg.handlePolkaEvent(ctx, event.Payload, event.CreatedAt)
+	event.Status, event.Error = status, sql.NullString{}
 	if err != nil {
-		log.Printf("Error selecting usr: %s", err)
-		respondWithError(w, http.StatusNotFound, err.Error())
+		log.Printf("Error processing webhook event %s: %s", event.ID, err)
+		event.Status = webhookStatusFailed
+		event.Error = sql.NullString{String: err.Error(), Valid: true}
+	}
+	event.ProcessedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	markErr := cfg.Db.MarkWebhookEvent(ctx, database.MarkWebhookEventParams{
+		ID:     event.ID,
+		Status: event.Status,
+		Error:  event.Error,
+	})
+	if markErr != nil {
+		log.Printf("Error updating webhook event: %s", markErr)
+	}
+	return err
+}
+
+// handlePolkaEvent applies a subscription event. Events without a timestamp
+// of their own are ordered by the time they were first received.
+func (cfg *ApiConfig) handlePolkaEvent(ctx context.Context, payload []byte, receivedAt time.Time) (string, error) {
+	params := polka_event{}
+	err := json.Unmarshal(payload, &params)
+	if err != nil {
+		return "", err
 	}
 
-	respondWithoutBody(w, http.StatusNoContent)
+	switch params.Event {
+	case "user.upgraded", "user.downgraded", "subscription.renewed",
+		"subscription.cancelled", "subscription.payment_failed":
+	default:
+		return webhookStatusIgnored, nil
+	}
+	uid, err := uuid.Parse(params.Data.UserId)
+	if err != nil {
+		return "", errWebhookUserNotFound
+	}
+	updtUsr, err := cfg.Db.SelectUserById(ctx, uid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errWebhookUserNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	eventAt := receivedAt
+	if params.CreatedAt != nil {
+		eventAt = params.CreatedAt.UTC()
+	}
+	periodEnd := sql.NullTime{}
+	if params.Data.CurrentPeriodEnd != nil {
+		periodEnd = sql.NullTime{Time: *params.Data.CurrentPeriodEnd, Valid: true}
+	}
+
+	// The row is locked while the event is applied, so concurrent events of
+	// the same user are applied one after the other.
+	status := webhookStatusProcessed
+	err = cfg.withTx(ctx, func(q *database.Queries) error {
+		err := q.EnsureSubscription(ctx, database.EnsureSubscriptionParams{UserID: updtUsr.ID, Plan: planChirpyRed})
+		if err != nil {
+			return err
+		}
+		sub, err := q.GetSubscriptionForUpdate(ctx, updtUsr.ID)
+		if err != nil {
+			return err
+		}
+		if sub.LastEventAt.Valid && eventAt.Before(sub.LastEventAt.Time) {
+			log.Printf("Ignoring polka event %s from %s, subscription changed at %s", params.Event, eventAt, sub.LastEventAt.Time)
+			status = webhookStatusIgnored
+			return nil
+		}
+
+		p := database.UpsertSubscriptionParams{
+			UserID:            sub.UserID,
+			Plan:              sub.Plan,
+			Status:            sub.Status,
+			CurrentPeriodEnd:  sub.CurrentPeriodEnd,
+			CancelAtPeriodEnd: sub.CancelAtPeriodEnd,
+			LastEventAt:       sql.NullTime{Time: eventAt, Valid: true},
+		}
+		switch params.Event {
+		case "user.upgraded", "subscription.renewed":
+			p.Status = subscriptionActive
+			p.CancelAtPeriodEnd = false
+			p.CurrentPeriodEnd = periodEnd
+			if params.Data.Plan != "" {
+				p.Plan = params.Data.Plan
+			}
+		case "subscription.cancelled":
+			if params.Data.CancelAtPeriodEnd {
+				p.CancelAtPeriodEnd = true
+				if periodEnd.Valid {
+					p.CurrentPeriodEnd = periodEnd
+				}
+			} else {
+				p.Status = subscriptionCanceled
+			}
+		case "subscription.payment_failed":
+			if p.Status == subscriptionActive {
+				p.Status = subscriptionPastDue
+			}
+		case "user.downgraded":
+			p.Status = subscriptionCanceled
+			p.CancelAtPeriodEnd = false
+		}
+		_, err = q.UpsertSubscription(ctx, p)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// verifyPolkaRequest accepts requests signed with one of the Polka webhook
+// secrets. Unsigned requests fall back to the old API key check unless that
+// is turned off. A request with a bad signature never falls back.
+func (cfg *ApiConfig) verifyPolkaRequest(w http.ResponseWriter, req *http.Request, body []byte) bool {
+	if cfg.PolkaVerifier != nil {
+		err := cfg.PolkaVerifier.Verify(req.Header, body)
+		if err == nil {
+			return true
+		}
+		if !errors.Is(err, webhook.ErrNoSignature) {
+			log.Printf("Rejected polka webhook: %s", err)
+			respondWithError(w, http.StatusUnauthorized, "Invalid signature")
+			return false
+		}
+	}
+
+	if !cfg.PolkaAllowAPIKey || cfg.PolkaKey == "" {
+		respondWithError(w, http.StatusUnauthorized, "Missing signature")
+		return false
+	}
+	key, err := auth.GetAPIKey(req.Header)
+	if err != nil {
+		log.Printf("Error fetching api key: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Something went wrong")
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(key), []byte(cfg.PolkaKey)) != 1 {
+		respondWithError(w, http.StatusUnauthorized, "Wrong API KEY")
+		return false
+	}
+	return true
 }
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/stream"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteTimeout     = 10 * time.Second
+	wsPongTimeout      = 60 * time.Second
+	wsPingInterval     = 30 * time.Second
+	wsAuthInterval     = time.Minute
+	wsMaxMessageSize   = 4096
+	wsMaxSubscriptions = 20
+	wsRequestBuffer    = 16
+
+	wsChannelHome     = "home"
+	wsChannelMentions = "mentions"
+	wsThreadPrefix    = "thread:"
+)
+
+var (
+	errWSUnknownChannel = errors.New("unknown channel")
+	errWSChirpNotFound  = errors.New("chirp not found")
+)
+
+// ws_request is a frame sent by the client.
+type ws_request struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+}
+
+// ws_frame is a frame sent by the server.
+type ws_frame struct {
+	Type    string          `json:"type"`
+	Channel string          `json:"channel,omitempty"`
+	Id      int64           `json:"id,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// ws_chirp_event holds the fields of a chirp.created or chirp.deleted
+// payload that decide which threads get the event.
+type ws_chirp_event struct {
+	Id      uuid.UUID     `json:"id"`
+	ReplyTo uuid.NullUUID `json:"reply_to"`
+}
+
+// wsSession is the state of one socket. following is read when home is
+// subscribed; follows made later count after subscribing again.
+type wsSession struct {
+	userID    uuid.UUID
+	channels  map[string]bool
+	following map[uuid.UUID]bool
+}
+
+// subscribe checks a channel before it is added. home is the timeline of
+// the user and the users they follow, mentions carries the user.mentioned
+// events of the user, and thread:<chirpID> a chirp and the replies to it.
+func (cfg *ApiConfig) subscribe(ctx context.Context, s *wsSession, channel string) error {
+	switch {
+	case channel == wsChannelHome:
+		ids, err := cfg.Db.ListFolloweeIDs(ctx, s.userID)
+		if err != nil {
+			return err
+		}
+		s.following = map[uuid.UUID]bool{}
+		for _, id := range ids {
+			s.following[id] = true
+		}
+	case channel == wsChannelMentions:
+		// Always the mentions of the socket's own user, there is no way
+		// to name someone else's.
+	case strings.HasPrefix(channel, wsThreadPrefix):
+		id, err := uuid.Parse(strings.TrimPrefix(channel, wsThreadPrefix))
+		if err != nil || wsThreadPrefix+id.String() != channel {
+			return errWSUnknownChannel
+		}
+		_, err = cfg.Db.GetOneChirp(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errWSChirpNotFound
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return errWSUnknownChannel
+	}
+	return nil
+}
+
+// matches decides if an event goes to a subscribed channel.
+func (s *wsSession) matches(channel string, event stream.Event) bool {
+	switch {
+	case channel == wsChannelHome:
+		return isChirpEvent(event.Type) && event.UserID.Valid &&
+			(event.UserID.UUID == s.userID || s.following[event.UserID.UUID])
+	case channel == wsChannelMentions:
+		return event.Type == "user.mentioned" && event.UserID.Valid && event.UserID.UUID == s.userID
+	case strings.HasPrefix(channel, wsThreadPrefix):
+		if !isChirpEvent(event.Type) {
+			return false
+		}
+		chirp := ws_chirp_event{}
+		if json.Unmarshal(event.Data, &chirp) != nil {
+			return false
+		}
+		root := strings.TrimPrefix(channel, wsThreadPrefix)
+		return chirp.Id.String() == root || (chirp.ReplyTo.Valid && chirp.ReplyTo.UUID.String() == root)
+	}
+	return false
+}
+
+// wsCheckOrigin only accepts browsers on our own origin, because the
+// session cookie authenticates the upgrade request.
+func (cfg *ApiConfig) wsCheckOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.Host) || strings.EqualFold(origin, cfg.BaseURL)
+}
+
+// WebSocketHandler upgrades to a WebSocket that carries live events. The
+// client sends {"type":"subscribe","channel":"home"} and receives
+// {"type":"event",...} frames for it.
+// It has to run behind RequireAuth.
+func (cfg *ApiConfig) WebSocketHandler(w http.ResponseWriter, req *http.Request) {
+	principal := PrincipalFromContext(req.Context())
+	upgrader := websocket.Upgrader{CheckOrigin: cfg.wsCheckOrigin}
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		log.Printf("Error upgrading websocket: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	sub := cfg.Events.Subscribe(streamBufferSize)
+	defer sub.Unsubscribe()
+
+	requests := make(chan ws_request, wsRequestBuffer)
+	readDone := make(chan struct{})
+	go wsReadLoop(conn, requests, readDone)
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	// The token is checked again while the socket is open, so revoking it,
+	// suspending the user or logging out everywhere also ends the socket.
+	// Access tokens without an expiry depend on this alone.
+	authCheck := time.NewTicker(wsAuthInterval)
+	defer authCheck.Stop()
+	var expired <-chan time.Time
+	if !principal.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(principal.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	// Only this goroutine writes to conn. Every write has a deadline, a
+	// client that stops reading makes its broker subscription overflow and
+	// is dropped without holding up anyone else.
+	write := func(frame ws_frame) bool {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(frame) == nil
+	}
+	closeWith := func(code int, reason string) {
+		msg := websocket.FormatCloseMessage(code, reason)
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+	}
+
+	session := &wsSession{userID: principal.UserID, channels: map[string]bool{}}
+	for {
+		select {
+		case <-readDone:
+			return
+		case <-expired:
+			closeWith(websocket.ClosePolicyViolation, "token expired")
+			return
+		case <-sub.Done():
+			if errors.Is(sub.Err(), stream.ErrClosed) {
+				closeWith(websocket.CloseGoingAway, "server shutting down")
+			} else {
+				closeWith(websocket.CloseTryAgainLater, "too slow, reconnect")
+			}
+			return
+		case <-authCheck.C:
+			p, err := cfg.resolvePrincipal(req)
+			if err != nil || p.UserID != principal.UserID {
+				log.Printf("Closing websocket of user %s: %v", principal.UserID, err)
+				closeWith(websocket.ClosePolicyViolation, "token no longer valid")
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if conn.WriteMessage(websocket.PingMessage, nil) != nil {
+				return
+			}
+		case r := <-requests:
+			if !write(cfg.handleWSRequest(req.Context(), session, r)) {
+				return
+			}
+		case event := <-sub.Events():
+			for channel := range session.channels {
+				if !session.matches(channel, event) {
+					continue
+				}
+				ok := write(ws_frame{Type: "event", Channel: channel, Id: event.ID, Event: event.Type, Data: event.Data})
+				if !ok {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (cfg *ApiConfig) handleWSRequest(ctx context.Context, s *wsSession, r ws_request) ws_frame {
+	switch r.Type {
+	case "ping":
+		return ws_frame{Type: "pong"}
+	case "subscribe":
+		if !s.channels[r.Channel] && len(s.channels) >= wsMaxSubscriptions {
+			return ws_frame{Type: "error", Channel: r.Channel, Message: "too many subscriptions"}
+		}
+		err := cfg.subscribe(ctx, s, r.Channel)
+		if errors.Is(err, errWSUnknownChannel) || errors.Is(err, errWSChirpNotFound) {
+			return ws_frame{Type: "error", Channel: r.Channel, Message: err.Error()}
+		}
+		if err != nil {
+			log.Printf("Error subscribing to %s: %s", r.Channel, err)
+			return ws_frame{Type: "error", Channel: r.Channel, Message: "something went wrong"}
+		}
+		s.channels[r.Channel] = true
+		return ws_frame{Type: "subscribed", Channel: r.Channel}
+	case "unsubscribe":
+		delete(s.channels, r.Channel)
+		return ws_frame{Type: "unsubscribed", Channel: r.Channel}
+	}
+	return ws_frame{Type: "error", Message: "unknown frame type"}
+}
+
+// wsReadLoop passes client frames on until the connection fails. A client
+// that does not answer pings for wsPongTimeout or floods requests is dropped.
+func wsReadLoop(conn *websocket.Conn, requests chan<- ws_request, done chan<- struct{}) {
+	defer close(done)
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		r := ws_request{}
+		if json.Unmarshal(msg, &r) != nil {
+			r = ws_request{Type: "invalid"}
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		select {
+		case requests <- r:
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/stream"
+	"github.com/google/uuid"
+)
+
+func newWSSession(userId uuid.UUID) *wsSession {
+	return &wsSession{userID: userId, channels: map[string]bool{}}
+}
+
+func chirpEvent(t *testing.T, eventType string, id, author uuid.UUID, replyTo uuid.NullUUID) stream.Event {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"id": id, "user_id": author, "reply_to": replyTo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream.Event{ID: 1, Type: eventType, UserID: uuid.NullUUID{UUID: author, Valid: true}, Data: data}
+}
+
+func TestWSSubscribeChecksChannels(t *testing.T) {
+	chirpId := uuid.New()
+	fake, db := newFakeDB(t)
+	fake.on("GetOneChirp", func(args []driver.Value) fakeResult {
+		if args[0] != chirpId.String() {
+			return fakeResult{}
+		}
+		now := time.Now()
+		return fakeResult{
+			columns: []string{"id", "created_at", "updated_at", "body", "user_id", "reply_to"},
+			rows:    [][]driver.Value{{chirpId.String(), now, now, "hello", uuid.NewString(), nil}},
+		}
+	})
+	cfg := &ApiConfig{Db: db}
+
+	cases := []struct {
+		channel  string
+		wantType string
+		wantMsg  string
+	}{
+		{"home", "subscribed", ""},
+		{"mentions", "subscribed", ""},
+		{"thread:" + chirpId.String(), "subscribed", ""},
+		{"thread:" + uuid.NewString(), "error", "chirp not found"},
+		{"thread:not-a-chirp", "error", "unknown channel"},
+		{"everything", "error", "unknown channel"},
+	}
+	for _, c := range cases {
+		s := newWSSession(uuid.New())
+		frame := cfg.handleWSRequest(context.Background(), s, ws_request{Type: "subscribe", Channel: c.channel})
+		if frame.Type != c.wantType || frame.Message != c.wantMsg {
+			t.Errorf("subscribe %s = %s %q, want %s %q", c.channel, frame.Type, frame.Message, c.wantType, c.wantMsg)
+		}
+		if s.channels[c.channel] != (c.wantType == "subscribed") {
+			t.Errorf("subscribe %s: channels = %v", c.channel, s.channels)
+		}
+	}
+}
+
+func TestWSHomeCarriesOwnAndFollowedChirps(t *testing.T) {
+	userId, followed, stranger := uuid.New(), uuid.New(), uuid.New()
+	fake, db := newFakeDB(t)
+	fake.on("ListFolloweeIDs", func(args []driver.Value) fakeResult {
+		return fakeResult{columns: []string{"followee_id"}, rows: [][]driver.Value{{followed.String()}}}
+	})
+	cfg := &ApiConfig{Db: db}
+	s := newWSSession(userId)
+	frame := cfg.handleWSRequest(context.Background(), s, ws_request{Type: "subscribe", Channel: wsChannelHome})
+	if frame.Type != "subscribed" {
+		t.Fatalf("subscribe home = %+v", frame)
+	}
+
+	cases := []struct {
+		name  string
+		event stream.Event
+		want  bool
+	}{
+		{"own chirp", chirpEvent(t, "chirp.created", uuid.New(), userId, uuid.NullUUID{}), true},
+		{"followed chirp", chirpEvent(t, "chirp.created", uuid.New(), followed, uuid.NullUUID{}), true},
+		{"followed deletion", chirpEvent(t, "chirp.deleted", uuid.New(), followed, uuid.NullUUID{}), true},
+		{"stranger chirp", chirpEvent(t, "chirp.created", uuid.New(), stranger, uuid.NullUUID{}), false},
+		{"other event", stream.Event{Type: "follow.created", UserID: uuid.NullUUID{UUID: userId, Valid: true}}, false},
+	}
+	for _, c := range cases {
+		if got := s.matches(wsChannelHome, c.event); got != c.want {
+			t.Errorf("%s: matches = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestWSMentionsCarriesOnlyOwnMentions(t *testing.T) {
+	userId := uuid.New()
+	s := newWSSession(userId)
+	cases := []struct {
+		name  string
+		event stream.Event
+		want  bool
+	}{
+		{"own mention", stream.Event{Type: "user.mentioned", UserID: uuid.NullUUID{UUID: userId, Valid: true}}, true},
+		{"someone else's mention", stream.Event{Type: "user.mentioned", UserID: uuid.NullUUID{UUID: uuid.New(), Valid: true}}, false},
+		{"own chirp", chirpEvent(t, "chirp.created", uuid.New(), userId, uuid.NullUUID{}), false},
+	}
+	for _, c := range cases {
+		if got := s.matches(wsChannelMentions, c.event); got != c.want {
+			t.Errorf("%s: matches = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestWSThreadCarriesChirpAndReplies(t *testing.T) {
+	root := uuid.New()
+	channel := wsThreadPrefix + root.String()
+	s := newWSSession(uuid.New())
+	cases := []struct {
+		name  string
+		event stream.Event
+		want  bool
+	}{
+		{"root deleted", chirpEvent(t, "chirp.deleted", root, uuid.New(), uuid.NullUUID{}), true},
+		{"reply", chirpEvent(t, "chirp.created", uuid.New(), uuid.New(), uuid.NullUUID{UUID: root, Valid: true}), true},
+		{"reply elsewhere", chirpEvent(t, "chirp.created", uuid.New(), uuid.New(), uuid.NullUUID{UUID: uuid.New(), Valid: true}), false},
+		{"unrelated chirp", chirpEvent(t, "chirp.created", uuid.New(), uuid.New(), uuid.NullUUID{}), false},
+	}
+	for _, c := range cases {
+		if got := s.matches(channel, c.event); got != c.want {
+			t.Errorf("%s: matches = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
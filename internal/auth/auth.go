@@ -2,6 +2,8 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
 	"net/http"
@@ -10,40 +12,41 @@ import (
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	pass := []byte(password)
-	hp, err := bcrypt.GenerateFromPassword(pass, 0)
-	if err != nil {
-		return "", err
-	}
-	return string(hp), nil
+type Claims struct {
+	jwt.RegisteredClaims
+	// Scope and ClientID are only set on tokens issued to OAuth clients.
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// AuthTime is only set on tokens issued right at a login, not on
+	// refreshed ones, so it tells how recently the user authenticated.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
 }
 
-func CheckPasswordHash(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword(
-		[]byte(hash),
-		[]byte(password))
-	if err != nil {
-		return err
-	}
+func MakeJWT(userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return makeJWT(Claims{}, userID, keys, expiresIn)
+}
 
-	return nil
+func MakeLoginJWT(userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return makeJWT(Claims{AuthTime: jwt.NewNumericDate(time.Now())}, userID, keys, expiresIn)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{
-		// A usual scenario is to set the expiration time relative to the current time
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		Issuer:    "chirpy",
-		Subject:   userID.String(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(tokenSecret))
+func MakeClientJWT(userID uuid.UUID, clientID string, scopes []string, keys *KeySet, expiresIn time.Duration) (string, error) {
+	claims := Claims{Scope: strings.Join(scopes, " "), ClientID: clientID}
+	claims.Audience = jwt.ClaimStrings{clientID}
+	return makeJWT(claims, userID, keys, expiresIn)
+}
+
+func makeJWT(claims Claims, userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	// A usual scenario is to set the expiration time relative to the current time
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(expiresIn))
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.NotBefore = jwt.NewNumericDate(time.Now())
+	claims.Issuer = "chirpy"
+	claims.Subject = userID.String()
+	claims.ID = uuid.NewString()
+	signedToken, err := keys.sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -51,26 +54,17 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return signedToken, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(tokenSecret), nil
-	})
+func ParseJWT(tokenString string, keys *KeySet) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys.keyFunc)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("token parsing failed: %v", err)
+		return nil, fmt.Errorf("token parsing failed: %v", err)
 	}
 
-	if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok && token.Valid {
-		userID, err := uuid.Parse(claims.Subject)
-		if err != nil {
-			return uuid.Nil, fmt.Errorf("invalid user ID in token: %v", err)
-		}
-		return userID, nil
-	} else {
-		return uuid.Nil, fmt.Errorf("invalid token")
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
 	}
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -99,6 +93,11 @@ func MakeRefreshToken() (string, error) {
 	return token, nil
 }
 
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 
 func GetAPIKey(headers http.Header) (string, error) {
 	authorization := headers.Get("Authorization")
@@ -113,4 +112,8 @@ func GetAPIKey(headers http.Header) (string, error) {
 		return "", fmt.Errorf("Authorization type wrong: %v", authorization)
 	}
 	return authParts[1], nil
-}
\ No newline at end of file
+}
+
+func TokenHashEqual(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
+}
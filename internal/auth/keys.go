@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type verificationKey struct {
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// KeySet holds the keys used to sign and verify JWTs. Tokens are signed with
+// the active key and carry its id in the kid header. All other keys still
+// verify, so tokens keep working while keys are rotated. Without asymmetric
+// keys the set falls back to HS256 with the shared secret.
+type KeySet struct {
+	secret []byte
+	keys   map[string]verificationKey
+	active string
+	// AcceptHS256 keeps HS256 tokens without a kid valid after asymmetric
+	// keys were configured. It is meant for the switch-over only; otherwise
+	// HS256 is accepted only while no asymmetric key exists.
+	AcceptHS256 bool
+}
+
+func NewKeySet(secret string) *KeySet {
+	return &KeySet{secret: []byte(secret), keys: map[string]verificationKey{}}
+}
+
+func (ks *KeySet) AddPrivateKey(kid string, key crypto.Signer) error {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		ks.keys[kid] = verificationKey{method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey}
+	case ed25519.PrivateKey:
+		ks.keys[kid] = verificationKey{method: jwt.SigningMethodEdDSA, private: k, public: k.Public()}
+	default:
+		return fmt.Errorf("unsupported private key type %T for kid %s", key, kid)
+	}
+	return nil
+}
+
+func (ks *KeySet) AddPublicKey(kid string, key crypto.PublicKey) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		ks.keys[kid] = verificationKey{method: jwt.SigningMethodRS256, public: k}
+	case ed25519.PublicKey:
+		ks.keys[kid] = verificationKey{method: jwt.SigningMethodEdDSA, public: k}
+	default:
+		return fmt.Errorf("unsupported public key type %T for kid %s", key, kid)
+	}
+	return nil
+}
+
+func (ks *KeySet) SetActive(kid string) error {
+	k, ok := ks.keys[kid]
+	if !ok || k.private == nil {
+		return fmt.Errorf("no private key with kid %s", kid)
+	}
+	ks.active = kid
+	return nil
+}
+
+// LoadKeys reads PEM files from dir. The file name without extension is the
+// kid. Private keys (PKCS#8 or PKCS#1) can sign, files ending in .pub.pem only
+// verify, which is how retired keys are kept around until their tokens expire.
+// Without an activeKid the last private key in name order signs. A dir with
+// only public keys is an error: tokens would be signed with HS256, which the
+// set no longer accepts once asymmetric keys exist.
+func (ks *KeySet) LoadKeys(dir, activeKid string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	lastPrivate := ""
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return fmt.Errorf("no PEM data in %s", file)
+		}
+
+		name := filepath.Base(file)
+		if strings.HasSuffix(name, ".pub.pem") {
+			kid := strings.TrimSuffix(name, ".pub.pem")
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("parsing public key %s failed: %v", file, err)
+			}
+			err = ks.AddPublicKey(kid, pub)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		kid := strings.TrimSuffix(name, ".pem")
+		var key any
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return fmt.Errorf("parsing private key %s failed: %v", file, err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("key in %s can not sign", file)
+		}
+		err = ks.AddPrivateKey(kid, signer)
+		if err != nil {
+			return err
+		}
+		lastPrivate = kid
+	}
+
+	if activeKid == "" {
+		activeKid = lastPrivate
+	}
+	if activeKid == "" {
+		if len(ks.keys) > 0 {
+			return fmt.Errorf("no private signing key in %s", dir)
+		}
+		return nil
+	}
+	return ks.SetActive(activeKid)
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	if ks.active == "" {
+		if len(ks.secret) == 0 {
+			return "", fmt.Errorf("no signing key configured")
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.secret)
+	}
+	k := ks.keys[ks.active]
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = ks.active
+	return token.SignedString(k.private)
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || len(ks.secret) == 0 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		if len(ks.keys) > 0 && !ks.AcceptHS256 {
+			return nil, fmt.Errorf("HS256 tokens are no longer accepted")
+		}
+		return ks.secret, nil
+	}
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return k.public, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key. The shared HS256
+// secret is never published.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		k := ks.keys[kid]
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: k.method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: kid,
+				Use: "sig",
+				Alg: k.method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
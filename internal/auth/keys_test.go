@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func writeKeyFile(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadKeysRequiresASigningKey(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDer, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writeKeyFile(t, dir, "2024-01.pub.pem", "PUBLIC KEY", pubDer)
+	if err := NewKeySet("secret").LoadKeys(dir, ""); err == nil {
+		t.Fatal("loaded a key dir without a private key")
+	}
+
+	writeKeyFile(t, dir, "2024-02.pem", "PRIVATE KEY", privDer)
+	ks := NewKeySet("secret")
+	if err := ks.LoadKeys(dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	token, err := MakeJWT(uuid.New(), ks, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseJWT(token, ks); err != nil {
+		t.Errorf("freshly signed token does not validate: %v", err)
+	}
+
+	if err := NewKeySet("secret").LoadKeys(t.TempDir(), ""); err != nil {
+		t.Errorf("an empty dir should fall back to HS256: %v", err)
+	}
+}
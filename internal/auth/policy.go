@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+type PasswordPolicy struct {
+	MinLength int
+	// MinEntropy is the minimum estimated strength in bits.
+	MinEntropy float64
+	// BreachedCorpus is a directory of k-anonymity range files, one per
+	// five character SHA-1 prefix, each holding SUFFIX:COUNT lines.
+	BreachedCorpus string
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:  8,
+	MinEntropy: 30,
+}
+
+// Check returns one message per rule the password violates. Values in
+// userInputs (like the email address) do not count towards the strength.
+func (p PasswordPolicy) Check(password string, userInputs ...string) []string {
+	var problems []string
+	if len([]rune(password)) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > 1024 {
+		problems = append(problems, "must be at most 1024 bytes long")
+	}
+	if p.MinEntropy > 0 && EstimateEntropy(password, userInputs...) < p.MinEntropy {
+		problems = append(problems, "is too easy to guess")
+	}
+	if p.BreachedCorpus != "" {
+		breached, err := p.isBreached(password)
+		if err != nil {
+			// The corpus is a best effort check, a missing file must not lock
+			// people out of creating accounts.
+			log.Printf("Breached password lookup failed: %s", err)
+		} else if breached {
+			problems = append(problems, "appeared in a data breach and can not be used")
+		}
+	}
+	return problems
+}
+
+func (p PasswordPolicy) isBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(p.BreachedCorpus, prefix+".txt"))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(p.BreachedCorpus, prefix))
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		entry, _, _ := strings.Cut(line, ":")
+		if strings.EqualFold(strings.TrimSpace(entry), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+var commonPasswordWords = []string{
+	"password", "passwort", "qwerty", "letmein", "welcome", "admin", "login",
+	"dragon", "monkey", "master", "shadow", "sunshine", "princess", "football",
+	"baseball", "iloveyou", "trustno1", "superman", "batman", "secret",
+	"chirpy", "chirp", "hello", "freedom", "whatever", "summer", "winter",
+}
+
+var keyboardRows = []string{
+	"1234567890",
+	"qwertyuiop",
+	"asdfghjkl",
+	"zxcvbnm",
+	"qwertzuiop",
+	"yxcvbnm",
+}
+
+// EstimateEntropy gives a rough, zxcvbn style estimate of the strength of a
+// password in bits. Repeats, sequences, keyboard runs, dictionary words and
+// the user's own data only add a few bits instead of a full character.
+func EstimateEntropy(password string, userInputs ...string) float64 {
+	if password == "" {
+		return 0
+	}
+	lower := strings.ToLower(password)
+
+	// Positions covered by a guessable pattern are charged a flat cost per
+	// pattern instead of per character.
+	covered := make([]bool, len(lower))
+	bits := 0.0
+
+	words := append([]string{}, commonPasswordWords...)
+	for _, in := range userInputs {
+		in = strings.ToLower(in)
+		if local, _, ok := strings.Cut(in, "@"); ok {
+			in = local
+		}
+		parts := strings.FieldsFunc(in, func(r rune) bool { return r == '.' || r == '_' || r == '-' || r == '+' })
+		for _, part := range append(parts, in) {
+			if len(part) >= 3 {
+				words = append(words, part)
+			}
+		}
+	}
+	unleeted := unleet(lower)
+	for _, word := range words {
+		for start := 0; ; {
+			idx := strings.Index(unleeted[start:], word)
+			if idx < 0 {
+				break
+			}
+			idx += start
+			if markCovered(covered, idx, len(word)) {
+				bits += math.Log2(float64(len(commonPasswordWords)))
+			}
+			start = idx + len(word)
+		}
+	}
+
+	runes := []rune(lower)
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && isPatternStep(runes[j-1], runes[j]) {
+			j++
+		}
+		if j-i >= 3 {
+			if markCovered(covered, byteOffset(lower, i), byteOffset(lower, j)-byteOffset(lower, i)) {
+				bits += math.Log2(float64(j-i)) + 4
+			}
+		}
+		i = j
+	}
+
+	pool := charsetSize(password)
+	for i := range lower {
+		if !covered[i] {
+			bits += math.Log2(pool)
+		}
+	}
+	return bits
+}
+
+func markCovered(covered []bool, start, length int) bool {
+	changed := false
+	for i := start; i < start+length && i < len(covered); i++ {
+		if !covered[i] {
+			covered[i] = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+func byteOffset(s string, runeIndex int) int {
+	n := 0
+	for i := range s {
+		if n == runeIndex {
+			return i
+		}
+		n++
+	}
+	return len(s)
+}
+
+// isPatternStep reports whether b continues a repeat ("aaa"), a sequence
+// ("abc", "321") or a keyboard run ("qwe") started by a.
+func isPatternStep(a, b rune) bool {
+	if a == b || b-a == 1 || a-b == 1 {
+		return true
+	}
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		if i >= 0 && i+1 < len(row) && rune(row[i+1]) == b {
+			return true
+		}
+	}
+	return false
+}
+
+func unleet(s string) string {
+	return strings.NewReplacer(
+		"4", "a", "@", "a", "3", "e", "1", "i", "!", "i",
+		"0", "o", "$", "s", "5", "s", "7", "t",
+	).Replace(s)
+}
+
+func charsetSize(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	size := 0.0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	return size
+}
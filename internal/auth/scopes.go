@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var KnownScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+const personalAccessTokenPrefix = "chirpy_pat_"
+
+// MakePersonalAccessToken returns a random token with a fixed prefix, so it
+// can be told apart from JWTs and found by secret scanners.
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return personalAccessTokenPrefix + token, nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
+
+func ParseScopes(scopes string) []string {
+	return strings.Fields(scopes)
+}
+
+func HasScope(scopes []string, scope string) bool {
+	return slices.Contains(scopes, scope)
+}
+
+func IsKnownScope(scope string) bool {
+	return slices.Contains(KnownScopes, scope)
+}
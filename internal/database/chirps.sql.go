@@ -7,25 +7,35 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
+WITH chirp AS (
+    INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to)
+    VALUES (
+        gen_random_uuid(), NOW(), NOW(), $1, $2, $3
+    )
+    RETURNING id, created_at, updated_at, body, user_id, reply_to
+), event AS (
+    INSERT INTO outbox_events (created_at, type, user_id, payload)
+    SELECT NOW(), 'chirp.created', user_id, jsonb_build_object('id', id, 'created_at', created_at, 'updated_at', updated_at, 'body', body, 'user_id', user_id, 'reply_to', reply_to)
+    FROM chirp
 )
-RETURNING id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, reply_to FROM chirp
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body    string
+	UserID  uuid.UUID
+	ReplyTo uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.ReplyTo)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -33,10 +43,48 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyTo,
 	)
 	return i, err
 }
 
+const createMentionEvents = `-- name: CreateMentionEvents :many
+INSERT INTO outbox_events (created_at, type, user_id, payload)
+SELECT NOW(), 'user.mentioned', u.id, jsonb_build_object('chirp_id', c.id, 'user_id', u.id, 'author_id', c.user_id, 'body', c.body, 'created_at', c.created_at)
+FROM chirps c
+JOIN users u ON u.username = ANY($1::TEXT[])
+WHERE c.id = $2 AND u.id <> c.user_id
+RETURNING user_id
+`
+
+type CreateMentionEventsParams struct {
+	Usernames []string
+	ChirpID   uuid.UUID
+}
+
+func (q *Queries) CreateMentionEvents(ctx context.Context, arg CreateMentionEventsParams) ([]uuid.NullUUID, error) {
+	rows, err := q.db.QueryContext(ctx, createMentionEvents, pq.Array(arg.Usernames), arg.ChirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.NullUUID
+	for rows.Next() {
+		var user_id uuid.NullUUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const deleteAllChirps = `-- name: DeleteAllChirps :exec
 DELETE FROM chirps
 `
@@ -47,7 +95,13 @@ func (q *Queries) DeleteAllChirps(ctx context.Context) error {
 }
 
 const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps WHERE id = $1
+WITH deleted AS (
+    DELETE FROM chirps WHERE id = $1
+    RETURNING id, user_id, reply_to
+)
+INSERT INTO outbox_events (created_at, type, user_id, payload)
+SELECT NOW(), 'chirp.deleted', user_id, jsonb_build_object('id', id, 'user_id', user_id, 'reply_to', reply_to)
+FROM deleted
 `
 
 func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
@@ -56,7 +110,7 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at ASC
+SELECT id, created_at, updated_at, body, user_id, reply_to FROM chirps ORDER BY created_at ASC
 `
 
 func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
@@ -74,6 +128,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyTo,
 		); err != nil {
 			return nil, err
 		}
@@ -89,7 +144,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getAllChirpsByAuthor = `-- name: GetAllChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE user_id = $1 ORDER BY created_at ASC
+SELECT id, created_at, updated_at, body, user_id, reply_to FROM chirps WHERE user_id = $1 ORDER BY created_at ASC
 `
 
 func (q *Queries) GetAllChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
@@ -107,6 +162,7 @@ func (q *Queries) GetAllChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyTo,
 		); err != nil {
 			return nil, err
 		}
@@ -122,7 +178,7 @@ func (q *Queries) GetAllChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([
 }
 
 const getAllChirpsByAuthorDesc = `-- name: GetAllChirpsByAuthorDesc :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE user_id = $1 ORDER BY created_at DESC
+SELECT id, created_at, updated_at, body, user_id, reply_to FROM chirps WHERE user_id = $1 ORDER BY created_at DESC
 `
 
 func (q *Queries) GetAllChirpsByAuthorDesc(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
@@ -140,6 +196,7 @@ func (q *Queries) GetAllChirpsByAuthorDesc(ctx context.Context, userID uuid.UUID
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyTo,
 		); err != nil {
 			return nil, err
 		}
@@ -155,7 +212,7 @@ func (q *Queries) GetAllChirpsByAuthorDesc(ctx context.Context, userID uuid.UUID
 }
 
 const getAllChirpsDesc = `-- name: GetAllChirpsDesc :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at DESC
+SELECT id, created_at, updated_at, body, user_id, reply_to FROM chirps ORDER BY created_at DESC
 `
 
 func (q *Queries) GetAllChirpsDesc(ctx context.Context) ([]Chirp, error) {
@@ -173,6 +230,7 @@ func (q *Queries) GetAllChirpsDesc(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyTo,
 		); err != nil {
 			return nil, err
 		}
@@ -188,7 +246,7 @@ func (q *Queries) GetAllChirpsDesc(ctx context.Context) ([]Chirp, error) {
 }
 
 const getOneChirp = `-- name: GetOneChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1 ORDER BY created_at ASC LIMIT 1
+SELECT id, created_at, updated_at, body, user_id, reply_to FROM chirps WHERE id = $1 ORDER BY created_at ASC LIMIT 1
 `
 
 func (q *Queries) GetOneChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -200,6 +258,29 @@ func (q *Queries) GetOneChirp(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyTo,
 	)
 	return i, err
 }
+
+const importChirp = `-- name: ImportChirp :execrows
+INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+SELECT gen_random_uuid(), $1, NOW(), $2, $3
+WHERE NOT EXISTS (
+    SELECT 1 FROM chirps WHERE user_id = $3 AND created_at = $1 AND body = $2
+)
+`
+
+type ImportChirpParams struct {
+	CreatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) ImportChirp(ctx context.Context, arg ImportChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, importChirp, arg.CreatedAt, arg.Body, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -6,17 +6,174 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	ReplyTo   uuid.NullUUID
+}
+
+type ChirpLike struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type Conversation struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	CreatedBy     uuid.NullUUID
+	LastMessageAt sql.NullTime
+}
+
+type ConversationMember struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	JoinedAt       time.Time
+	LastReadAt     sql.NullTime
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	Email     string
+	UserID    uuid.UUID
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Job struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Type       string
+	Status     string
+	Payload    json.RawMessage
+	Result     json.RawMessage
+	Error      sql.NullString
+	Attempts   int32
+	StartedAt  sql.NullTime
+	FinishedAt sql.NullTime
+	UserID     uuid.UUID
+}
+
+type LoginAttempt struct {
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type MagicLinkToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	NonceHash string
+	UserID    uuid.UUID
+}
+
+type Message struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	ActorID   uuid.UUID
+	Type      string
+	TargetID  uuid.NullUUID
+	ReadAt    sql.NullTime
+}
+
+type NotificationPreference struct {
+	UserID  uuid.UUID
+	Type    string
+	Enabled bool
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+	RedirectUri   string
+	Scopes        string
+	CodeChallenge string
+	ClientID      string
+	UserID        uuid.UUID
+}
+
+type OauthClient struct {
+	ID           string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris string
+	Scopes       string
+	UserID       uuid.UUID
+}
+
+type OutboxCursor struct {
+	Name   string
+	LastID int64
+}
+
+type OutboxEvent struct {
+	ID        int64
+	CreatedAt time.Time
+	Type      string
+	UserID    uuid.NullUUID
+	Payload   json.RawMessage
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	UserID    uuid.UUID
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Name       string
+	TokenHash  string
+	Scopes     string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+	UserID     uuid.UUID
 }
 
 type RefreshToken struct {
@@ -26,13 +183,109 @@ type RefreshToken struct {
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
 	UserID    uuid.UUID
+	ClientID  sql.NullString
+	Scopes    string
+}
+
+type RevokedJwt struct {
+	Jti       string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type Subscription struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	UserID            uuid.UUID
+	Plan              string
+	Status            string
+	CurrentPeriodEnd  sql.NullTime
+	CancelAtPeriodEnd bool
+	LastEventAt       sql.NullTime
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	EmailVerifiedAt     sql.NullTime
+	Role                string
+	TokensValidAfter    sql.NullTime
+	SuspendedAt         sql.NullTime
+	DeletionScheduledAt sql.NullTime
+	DmPermission        string
+	Username            sql.NullString
+}
+
+type UserIdentity struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Provider  string
+	Subject   string
+	Email     string
+	UserID    uuid.UUID
+}
+
+type WebauthnChallenge struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Ceremony  string
+	Challenge string
+	UserID    uuid.NullUUID
+}
+
+type WebauthnCredential struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	Name         string
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    int64
+	LastUsedAt   sql.NullTime
+	UserID       uuid.UUID
+}
+
+type WebhookDelivery struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	EndpointID    uuid.UUID
+	EventID       int64
+	EventType     string
+	Payload       json.RawMessage
+	Status        string
+	Attempts      int32
+	NextAttemptAt time.Time
+	ResponseCode  sql.NullInt32
+	Error         sql.NullString
+	DeliveredAt   sql.NullTime
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.NullUUID
+	Url       string
+	Secret    string
+	Events    string
+}
+
+type WebhookEvent struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Provider    string
+	EventID     string
+	EventType   string
+	Status      string
+	Payload     json.RawMessage
+	Error       sql.NullString
+	Attempts    int32
+	ProcessedAt sql.NullTime
 }
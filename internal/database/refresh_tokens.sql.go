@@ -7,17 +7,56 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const createClientToken = `-- name: CreateClientToken :one
+INSERT INTO refresh_tokens (token, created_at, updated_at, expires_at, user_id, client_id, scopes)
+VALUES (
+    $1, NOW(), NOW(), $2, $3, $4, $5
+)
+RETURNING token, created_at, updated_at, expires_at, revoked_at, user_id, client_id, scopes
+`
+
+type CreateClientTokenParams struct {
+	Token     string
+	ExpiresAt time.Time
+	UserID    uuid.UUID
+	ClientID  sql.NullString
+	Scopes    string
+}
+
+func (q *Queries) CreateClientToken(ctx context.Context, arg CreateClientTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, createClientToken,
+		arg.Token,
+		arg.ExpiresAt,
+		arg.UserID,
+		arg.ClientID,
+		arg.Scopes,
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.UserID,
+		&i.ClientID,
+		&i.Scopes,
+	)
+	return i, err
+}
+
 const createToken = `-- name: CreateToken :one
 INSERT INTO refresh_tokens (token, created_at, updated_at, expires_at, user_id)
 VALUES (
     $1, NOW(), NOW(), $2, $3
 )
-RETURNING token, created_at, updated_at, expires_at, revoked_at, user_id
+RETURNING token, created_at, updated_at, expires_at, revoked_at, user_id, client_id, scopes
 `
 
 type CreateTokenParams struct {
@@ -36,12 +75,14 @@ func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (Refre
 		&i.ExpiresAt,
 		&i.RevokedAt,
 		&i.UserID,
+		&i.ClientID,
+		&i.Scopes,
 	)
 	return i, err
 }
 
 const getOneToken = `-- name: GetOneToken :one
-SELECT token, created_at, updated_at, expires_at, revoked_at, user_id FROM refresh_tokens WHERE token = $1 ORDER BY created_at DESC LIMIT 1
+SELECT token, created_at, updated_at, expires_at, revoked_at, user_id, client_id, scopes FROM refresh_tokens WHERE token = $1 ORDER BY created_at DESC LIMIT 1
 `
 
 func (q *Queries) GetOneToken(ctx context.Context, token string) (RefreshToken, error) {
@@ -54,10 +95,48 @@ func (q *Queries) GetOneToken(ctx context.Context, token string) (RefreshToken,
 		&i.ExpiresAt,
 		&i.RevokedAt,
 		&i.UserID,
+		&i.ClientID,
+		&i.Scopes,
 	)
 	return i, err
 }
 
+const listUserTokens = `-- name: ListUserTokens :many
+SELECT token, created_at, updated_at, expires_at, revoked_at, user_id, client_id, scopes FROM refresh_tokens WHERE user_id = $1 ORDER BY created_at DESC
+`
+
+func (q *Queries) ListUserTokens(ctx context.Context, userID uuid.UUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, listUserTokens, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.Token,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.UserID,
+			&i.ClientID,
+			&i.Scopes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const revokeToken = `-- name: RevokeToken :exec
 UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE token = $1
 `
@@ -66,3 +145,12 @@ func (q *Queries) RevokeToken(ctx context.Context, token string) error {
 	_, err := q.db.ExecContext(ctx, revokeToken, token)
 	return err
 }
+
+const revokeUserTokens = `-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserTokens, userID)
+	return err
+}
@@ -7,16 +7,36 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :execrows
+WITH cancelled AS (
+    UPDATE users SET deletion_scheduled_at = NULL, updated_at = NOW()
+    WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+    RETURNING id
+)
+INSERT INTO outbox_events (created_at, type, user_id, payload)
+SELECT NOW(), 'user.deletion_cancelled', id, jsonb_build_object('user_id', id)
+FROM cancelled
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
     gen_random_uuid(), NOW(), NOW(), $1, $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, role, tokens_valid_after, suspended_at, deletion_scheduled_at, dm_permission, username
 `
 
 type CreateUserParams struct {
@@ -33,7 +53,46 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+		&i.DmPermission,
+		&i.Username,
+	)
+	return i, err
+}
+
+const createVerifiedUser = `-- name: CreateVerifiedUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, email_verified_at)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, NOW()
+)
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, role, tokens_valid_after, suspended_at, deletion_scheduled_at, dm_permission, username
+`
+
+type CreateVerifiedUserParams struct {
+	Email          string
+	HashedPassword string
+}
+
+func (q *Queries) CreateVerifiedUser(ctx context.Context, arg CreateVerifiedUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, createVerifiedUser, arg.Email, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+		&i.DmPermission,
+		&i.Username,
 	)
 	return i, err
 }
@@ -47,8 +106,108 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const invalidateUserTokens = `-- name: InvalidateUserTokens :exec
+UPDATE users SET tokens_valid_after = $2 WHERE id = $1
+`
+
+type InvalidateUserTokensParams struct {
+	ID               uuid.UUID
+	TokensValidAfter sql.NullTime
+}
+
+func (q *Queries) InvalidateUserTokens(ctx context.Context, arg InvalidateUserTokensParams) error {
+	_, err := q.db.ExecContext(ctx, invalidateUserTokens, arg.ID, arg.TokensValidAfter)
+	return err
+}
+
+const listUsersDueForDeletion = `-- name: ListUsersDueForDeletion :many
+SELECT id FROM users WHERE deletion_scheduled_at <= NOW() ORDER BY deletion_scheduled_at LIMIT $1
+`
+
+func (q *Queries) ListUsersDueForDeletion(ctx context.Context, limit int32) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersDueForDeletion, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :execrows
+UPDATE users SET email_verified_at = NOW(), updated_at = NOW() WHERE id = $1 AND email = $2
+`
+
+type MarkEmailVerifiedParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markEmailVerified, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const purgeUser = `-- name: PurgeUser :execrows
+WITH deleted AS (
+    DELETE FROM users WHERE id = $1 AND deletion_scheduled_at <= NOW()
+    RETURNING id
+)
+INSERT INTO outbox_events (created_at, type, user_id, payload)
+SELECT NOW(), 'user.deleted', id, jsonb_build_object('user_id', id)
+FROM deleted
+`
+
+func (q *Queries) PurgeUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :execrows
+WITH scheduled AS (
+    UPDATE users SET deletion_scheduled_at = $2, updated_at = NOW()
+    WHERE id = $1 AND deletion_scheduled_at IS NULL
+    RETURNING id, deletion_scheduled_at
+)
+INSERT INTO outbox_events (created_at, type, user_id, payload)
+SELECT NOW(), 'user.deletion_scheduled', id, jsonb_build_object('user_id', id, 'deletion_scheduled_at', deletion_scheduled_at)
+FROM scheduled
+`
+
+type ScheduleUserDeletionParams struct {
+	ID                  uuid.UUID
+	DeletionScheduledAt sql.NullTime
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, scheduleUserDeletion, arg.ID, arg.DeletionScheduledAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const selectUserByEmail = `-- name: SelectUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email like $1 LIMIT 1
+SELECT id, created_at, updated_at, email, hashed_password, email_verified_at, role, tokens_valid_after, suspended_at, deletion_scheduled_at, dm_permission, username FROM users WHERE email like $1 LIMIT 1
 `
 
 func (q *Queries) SelectUserByEmail(ctx context.Context, email string) (User, error) {
@@ -60,13 +219,19 @@ func (q *Queries) SelectUserByEmail(ctx context.Context, email string) (User, er
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+		&i.DmPermission,
+		&i.Username,
 	)
 	return i, err
 }
 
 const selectUserById = `-- name: SelectUserById :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE id = $1 LIMIT 1
+SELECT id, created_at, updated_at, email, hashed_password, email_verified_at, role, tokens_valid_after, suspended_at, deletion_scheduled_at, dm_permission, username FROM users WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) SelectUserById(ctx context.Context, id uuid.UUID) (User, error) {
@@ -78,27 +243,50 @@ func (q *Queries) SelectUserById(ctx context.Context, id uuid.UUID) (User, error
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+		&i.DmPermission,
+		&i.Username,
 	)
 	return i, err
 }
 
-const updateChirpyRed = `-- name: UpdateChirpyRed :exec
-UPDATE users SET is_chirpy_red = $1, updated_at = NOW() WHERE id = $2
+const setUserSuspended = `-- name: SetUserSuspended :execrows
+UPDATE users SET suspended_at = $2, updated_at = NOW() WHERE id = $1
 `
 
-type UpdateChirpyRedParams struct {
-	IsChirpyRed bool
+type SetUserSuspendedParams struct {
 	ID          uuid.UUID
+	SuspendedAt sql.NullTime
 }
 
-func (q *Queries) UpdateChirpyRed(ctx context.Context, arg UpdateChirpyRedParams) error {
-	_, err := q.db.ExecContext(ctx, updateChirpyRed, arg.IsChirpyRed, arg.ID)
+func (q *Queries) SetUserSuspended(ctx context.Context, arg SetUserSuspendedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserSuspended, arg.ID, arg.SuspendedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateDmPermission = `-- name: UpdateDmPermission :exec
+UPDATE users SET dm_permission = $2, updated_at = NOW() WHERE id = $1
+`
+
+type UpdateDmPermissionParams struct {
+	ID           uuid.UUID
+	DmPermission string
+}
+
+func (q *Queries) UpdateDmPermission(ctx context.Context, arg UpdateDmPermissionParams) error {
+	_, err := q.db.ExecContext(ctx, updateDmPermission, arg.ID, arg.DmPermission)
 	return err
 }
 
 const updateEmailAndPassword = `-- name: UpdateEmailAndPassword :exec
-UPDATE users SET hashed_password = $1, email =$2, updated_at = NOW() WHERE id = $3
+UPDATE users SET hashed_password = $1, email = $2, email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END, updated_at = NOW() WHERE id = $3
 `
 
 type UpdateEmailAndPasswordParams struct {
@@ -111,3 +299,31 @@ func (q *Queries) UpdateEmailAndPassword(ctx context.Context, arg UpdateEmailAnd
 	_, err := q.db.ExecContext(ctx, updateEmailAndPassword, arg.HashedPassword, arg.Email, arg.ID)
 	return err
 }
+
+const updatePassword = `-- name: UpdatePassword :exec
+UPDATE users SET hashed_password = $1, updated_at = NOW() WHERE id = $2
+`
+
+type UpdatePasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdatePassword(ctx context.Context, arg UpdatePasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updatePassword, arg.HashedPassword, arg.ID)
+	return err
+}
+
+const updateUsername = `-- name: UpdateUsername :exec
+UPDATE users SET username = $2, updated_at = NOW() WHERE id = $1
+`
+
+type UpdateUsernameParams struct {
+	ID       uuid.UUID
+	Username sql.NullString
+}
+
+func (q *Queries) UpdateUsername(ctx context.Context, arg UpdateUsernameParams) error {
+	_, err := q.db.ExecContext(ctx, updateUsername, arg.ID, arg.Username)
+	return err
+}
@@ -0,0 +1,180 @@
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type Attempt struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Store keeps failed attempts per key. RecordFailure must increment
+// atomically, and start counting from one again when the previous failure
+// is older than resetAfter. Lock locks the key for d from now, by the same
+// clock the store uses for the failure times.
+type Store interface {
+	Get(ctx context.Context, key string) (Attempt, error)
+	RecordFailure(ctx context.Context, key string, resetAfter time.Duration) (Attempt, error)
+	Lock(ctx context.Context, key string, d time.Duration) error
+	Reset(ctx context.Context, key string) error
+}
+
+type Policy struct {
+	// FreeAttempts failures are allowed before the key gets locked.
+	FreeAttempts int
+	// Every failure after that doubles the lock, starting at BaseDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// ResetAfter without failures the counter starts over.
+	ResetAfter time.Duration
+}
+
+var DefaultAccountPolicy = Policy{
+	FreeAttempts: 5,
+	BaseDelay:    30 * time.Second,
+	MaxDelay:     15 * time.Minute,
+	ResetAfter:   time.Hour,
+}
+
+var DefaultIPPolicy = Policy{
+	FreeAttempts: 20,
+	BaseDelay:    time.Minute,
+	MaxDelay:     time.Hour,
+	ResetAfter:   time.Hour,
+}
+
+// Sign-in emails are limited on every send, not only on failures, so the
+// endpoints can not be used to flood an inbox.
+var DefaultMailAccountPolicy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    5 * time.Minute,
+	MaxDelay:     time.Hour,
+	ResetAfter:   time.Hour,
+}
+
+var DefaultMailIPPolicy = Policy{
+	FreeAttempts: 10,
+	BaseDelay:    5 * time.Minute,
+	MaxDelay:     time.Hour,
+	ResetAfter:   time.Hour,
+}
+
+// Starting a passkey login stores a challenge, so it is limited per IP.
+var DefaultCeremonyIPPolicy = Policy{
+	FreeAttempts: 30,
+	BaseDelay:    time.Minute,
+	MaxDelay:     15 * time.Minute,
+	ResetAfter:   10 * time.Minute,
+}
+
+func (p Policy) lockFor(failures int) time.Duration {
+	over := failures - p.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := 1; i < over && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+type Limiter struct {
+	Store   Store
+	Account Policy
+	IP      Policy
+	// Prefix separates the keys of limiters sharing a store.
+	Prefix string
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{Store: store, Account: DefaultAccountPolicy, IP: DefaultIPPolicy}
+}
+
+func NewMailLimiter(store Store) *Limiter {
+	return &Limiter{Store: store, Account: DefaultMailAccountPolicy, IP: DefaultMailIPPolicy, Prefix: "mail:"}
+}
+
+func NewCeremonyLimiter(store Store) *Limiter {
+	return &Limiter{Store: store, IP: DefaultCeremonyIPPolicy, Prefix: "passkey:"}
+}
+
+func (l *Limiter) accountKey(email string) string {
+	return l.Prefix + "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func (l *Limiter) ipKey(ip string) string {
+	return l.Prefix + "ip:" + ip
+}
+
+// RetryAfter returns how long the caller has to wait before the next login
+// attempt for this account or IP is allowed. Zero means go ahead.
+func (l *Limiter) RetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range []string{l.accountKey(email), l.ipKey(ip)} {
+		a, err := l.Store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if d := time.Until(a.LockedUntil); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// RetryAfterIP is RetryAfter for requests that are not tied to an account.
+func (l *Limiter) RetryAfterIP(ctx context.Context, ip string) (time.Duration, error) {
+	a, err := l.Store.Get(ctx, l.ipKey(ip))
+	if err != nil {
+		return 0, err
+	}
+	return max(time.Until(a.LockedUntil), 0), nil
+}
+
+func (l *Limiter) Failed(ctx context.Context, email, ip string) error {
+	err := l.fail(ctx, l.accountKey(email), l.Account)
+	if err != nil {
+		return err
+	}
+	return l.fail(ctx, l.ipKey(ip), l.IP)
+}
+
+// Attempted counts an attempt that is limited whether it succeeds or not.
+func (l *Limiter) Attempted(ctx context.Context, email, ip string) error {
+	return l.Failed(ctx, email, ip)
+}
+
+// AttemptedIP counts an attempt that is not tied to an account.
+func (l *Limiter) AttemptedIP(ctx context.Context, ip string) error {
+	return l.fail(ctx, l.ipKey(ip), l.IP)
+}
+
+func (l *Limiter) fail(ctx context.Context, key string, p Policy) error {
+	a, err := l.Store.RecordFailure(ctx, key, p.ResetAfter)
+	if err != nil {
+		return err
+	}
+	if d := p.lockFor(a.Failures); d > 0 {
+		return l.Store.Lock(ctx, key, d)
+	}
+	return nil
+}
+
+// Succeeded clears the account counter. The IP counter is left alone so a
+// single valid login does not reset guessing against other accounts.
+func (l *Limiter) Succeeded(ctx context.Context, email string) error {
+	return l.Store.Reset(ctx, l.accountKey(email))
+}
+
+// Forget removes the account counter, e.g. when the account is deleted.
+func (l *Limiter) Forget(ctx context.Context, email string) error {
+	return l.Store.Reset(ctx, l.accountKey(email))
+}
@@ -0,0 +1,187 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func failLogins(t *testing.T, l *Limiter, n int, email, ip string) {
+	t.Helper()
+	for range n {
+		if err := l.Failed(context.Background(), email, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoginLockedAfterFreeAttempts(t *testing.T) {
+	ctx := context.Background()
+	login := NewLimiter(NewMemoryStore())
+
+	failLogins(t, login, login.Account.FreeAttempts, "a@example.com", "1.1.1.1")
+	wait, err := login.RetryAfter(ctx, "a@example.com", "1.1.1.1")
+	if err != nil || wait > 0 {
+		t.Fatalf("locked within the free attempts: %v %v", wait, err)
+	}
+
+	failLogins(t, login, 1, "a@example.com", "2.2.2.2")
+	wait, err = login.RetryAfter(ctx, "a@example.com", "3.3.3.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= login.Account.BaseDelay-time.Second || wait > login.Account.BaseDelay {
+		t.Errorf("first lock is %v, want about %v", wait, login.Account.BaseDelay)
+	}
+	wait, err = login.RetryAfter(ctx, "b@example.com", "3.3.3.3")
+	if err != nil || wait > 0 {
+		t.Errorf("another account was locked: %v %v", wait, err)
+	}
+}
+
+func TestLoginLockDoublesUpToMaxDelay(t *testing.T) {
+	p := DefaultAccountPolicy
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{p.FreeAttempts, 0},
+		{p.FreeAttempts + 1, p.BaseDelay},
+		{p.FreeAttempts + 2, 2 * p.BaseDelay},
+		{p.FreeAttempts + 3, 4 * p.BaseDelay},
+		{p.FreeAttempts + 100, p.MaxDelay},
+	}
+	for _, c := range cases {
+		if got := p.lockFor(c.failures); got != c.want {
+			t.Errorf("lockFor(%d) = %v, want %v", c.failures, got, c.want)
+		}
+	}
+}
+
+func TestLoginLockedUntilIsStored(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	login := NewLimiter(store)
+
+	before := time.Now()
+	failLogins(t, login, login.Account.FreeAttempts+2, "a@example.com", "1.1.1.1")
+	a, err := store.Get(ctx, login.accountKey("a@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Failures != login.Account.FreeAttempts+2 {
+		t.Errorf("failures = %d", a.Failures)
+	}
+	want := before.Add(2 * login.Account.BaseDelay)
+	if a.LockedUntil.Before(want) || a.LockedUntil.After(time.Now().Add(2*login.Account.BaseDelay)) {
+		t.Errorf("locked_until = %v, want about %v", a.LockedUntil, want)
+	}
+}
+
+func TestLoginSuccessResetsAccountOnly(t *testing.T) {
+	ctx := context.Background()
+	login := NewLimiter(NewMemoryStore())
+	login.IP.FreeAttempts = login.Account.FreeAttempts
+
+	failLogins(t, login, login.Account.FreeAttempts+1, "a@example.com", "1.1.1.1")
+	if err := login.Succeeded(ctx, "a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	wait, err := login.RetryAfter(ctx, "a@example.com", "2.2.2.2")
+	if err != nil || wait > 0 {
+		t.Errorf("account still locked after a successful login: %v %v", wait, err)
+	}
+	wait, err = login.RetryAfterIP(ctx, "1.1.1.1")
+	if err != nil || wait <= 0 {
+		t.Errorf("a successful login cleared the ip counter: %v %v", wait, err)
+	}
+}
+
+func TestMailLimiterCountsEveryAttempt(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	mail := NewMailLimiter(store)
+
+	for i := range mail.Account.FreeAttempts {
+		wait, err := mail.RetryAfter(ctx, "a@example.com", "1.1.1.1")
+		if err != nil || wait > 0 {
+			t.Fatalf("attempt %d was limited: %v %v", i+1, wait, err)
+		}
+		if err := mail.Attempted(ctx, "a@example.com", "1.1.1.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mail.Attempted(ctx, "A@example.com ", "2.2.2.2"); err != nil {
+		t.Fatal(err)
+	}
+
+	wait, err := mail.RetryAfter(ctx, "a@example.com", "3.3.3.3")
+	if err != nil || wait <= 0 {
+		t.Errorf("address was not limited after %d sends from several ips: %v %v", mail.Account.FreeAttempts+1, wait, err)
+	}
+	wait, err = mail.RetryAfter(ctx, "b@example.com", "3.3.3.3")
+	if err != nil || wait > 0 {
+		t.Errorf("another address was limited: %v %v", wait, err)
+	}
+}
+
+func TestMailLimiterPerIP(t *testing.T) {
+	ctx := context.Background()
+	mail := NewMailLimiter(NewMemoryStore())
+
+	for i := range mail.IP.FreeAttempts + 1 {
+		email := string(rune('a'+i)) + "@example.com"
+		if err := mail.Attempted(ctx, email, "1.1.1.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait, err := mail.RetryAfter(ctx, "new@example.com", "1.1.1.1")
+	if err != nil || wait <= 0 {
+		t.Errorf("ip was not limited: %v %v", wait, err)
+	}
+}
+
+func TestLimitersSharingAStoreAreSeparate(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	login := NewLimiter(store)
+	mail := NewMailLimiter(store)
+
+	for range mail.Account.FreeAttempts + 1 {
+		if err := mail.Attempted(ctx, "a@example.com", "1.1.1.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait, err := login.RetryAfter(ctx, "a@example.com", "1.1.1.1")
+	if err != nil || wait > 0 {
+		t.Errorf("sending emails locked the password login: %v %v", wait, err)
+	}
+}
+
+func TestMemoryStoreExpiresEntriesByTheirOwnPolicy(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	login := NewLimiter(store)
+	ceremony := NewCeremonyLimiter(store)
+
+	if err := login.Failed(ctx, "a@example.com", "1.1.1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ceremony.AttemptedIP(ctx, "1.1.1.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	store.mu.Lock()
+	store.gc(time.Now().Add(20 * time.Minute))
+	_, loginKept := store.attempts[login.accountKey("a@example.com")]
+	_, ceremonyKept := store.attempts[ceremony.ipKey("1.1.1.1")]
+	store.mu.Unlock()
+
+	if !loginKept {
+		t.Error("login counter was dropped after the ceremony reset time")
+	}
+	if ceremonyKept {
+		t.Error("ceremony counter was kept past its reset time")
+	}
+}
@@ -0,0 +1,78 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps attempts in process memory. It is only correct when a
+// single server instance handles all logins.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]memoryEntry
+	lastGC   time.Time
+}
+
+// memoryEntry remembers the resetAfter of the limiter that wrote it, so
+// limiters with different policies can share a store.
+type memoryEntry struct {
+	Attempt
+	resetAfter time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string]memoryEntry{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[key].Attempt, nil
+}
+
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, resetAfter time.Duration) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.gc(now)
+
+	e := s.attempts[key]
+	if now.Sub(e.LastFailureAt) > resetAfter {
+		e.Failures = 0
+	}
+	e.Failures++
+	e.LastFailureAt = now
+	e.resetAfter = resetAfter
+	s.attempts[key] = e
+	return e.Attempt, nil
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.attempts[key]
+	e.LockedUntil = time.Now().Add(d)
+	s.attempts[key] = e
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *MemoryStore) gc(now time.Time) {
+	if now.Sub(s.lastGC) < time.Minute {
+		return
+	}
+	s.lastGC = now
+	for key, e := range s.attempts {
+		if now.Sub(e.LastFailureAt) > e.resetAfter && now.After(e.LockedUntil) {
+			delete(s.attempts, key)
+		}
+	}
+}
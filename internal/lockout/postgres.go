@@ -0,0 +1,59 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+)
+
+// PostgresStore shares attempts between all replicas through the
+// login_attempts table.
+type PostgresStore struct {
+	Db *database.Queries
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Attempt, error) {
+	row, err := s.Db.GetLoginAttempt(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attempt{}, nil
+	}
+	if err != nil {
+		return Attempt{}, err
+	}
+	return toAttempt(row), nil
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, resetAfter time.Duration) (Attempt, error) {
+	row, err := s.Db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:               key,
+		ResetAfterSeconds: int32(resetAfter.Seconds()),
+	})
+	if err != nil {
+		return Attempt{}, err
+	}
+	return toAttempt(row), nil
+}
+
+// Lock computes locked_until with the database clock, like the failure
+// times written by RecordFailure.
+func (s *PostgresStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	return s.Db.LockLoginAttempt(ctx, database.LockLoginAttemptParams{
+		Key:         key,
+		LockSeconds: int32(d.Seconds()),
+	})
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.Db.DeleteLoginAttempt(ctx, key)
+}
+
+func toAttempt(row database.LoginAttempt) Attempt {
+	a := Attempt{Failures: int(row.Failures), LastFailureAt: row.LastFailureAt}
+	if row.LockedUntil.Valid {
+		a.LockedUntil = row.LockedUntil.Time
+	}
+	return a
+}
@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer writes messages to a file (or stdout) instead of delivering them.
+// It is meant for local development and tests.
+type LogMailer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewLogMailer(path string) (*LogMailer, error) {
+	if path == "" {
+		return &LogMailer{out: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening mail log failed: %v", err)
+	}
+	return &LogMailer{out: f}, nil
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.out, "----- %s -----\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+	return err
+}
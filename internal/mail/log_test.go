@@ -0,0 +1,43 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogMailerAppendsMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m, err := NewLogMailer(path)
+	if err != nil {
+		t.Fatalf("NewLogMailer: %v", err)
+	}
+
+	msgs := []Message{
+		{To: "a@example.com", Subject: "Reset your Chirpy password", Body: "token=abc"},
+		{To: "b@example.com", Subject: "Verify your email", Body: "token=def"},
+	}
+	for _, msg := range msgs {
+		if err := m.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading mail log: %v", err)
+	}
+	out := string(data)
+	for _, msg := range msgs {
+		for _, want := range []string{"To: " + msg.To, "Subject: " + msg.Subject, msg.Body} {
+			if !strings.Contains(out, want) {
+				t.Errorf("mail log is missing %q:\n%s", want, out)
+			}
+		}
+	}
+	if strings.Index(out, msgs[0].To) > strings.Index(out, msgs[1].To) {
+		t.Errorf("messages were not appended in order:\n%s", out)
+	}
+}
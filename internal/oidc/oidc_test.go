@@ -0,0 +1,153 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/auth"
+	"github.com/DmitrijP/my-go-server/internal/oidc"
+	"github.com/DmitrijP/my-go-server/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const verifier = "0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func newProvider(iss *oidctest.Issuer) *oidc.Provider {
+	return oidc.NewProvider(iss.URL, iss.ClientID, iss.ClientSecret, "http://chirpy.test/api/login/oidc/callback")
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	iss := oidctest.NewIssuer("chirpy", "secret")
+	defer iss.Close()
+
+	u, err := newProvider(iss).AuthCodeURL(context.Background(), "state-1", "nonce-1", auth.PKCEChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if !strings.HasPrefix(u, iss.URL+"/authorize?") {
+		t.Fatalf("unexpected authorization url %s", u)
+	}
+	for _, want := range []string{"state=state-1", "nonce=nonce-1", "client_id=chirpy", "code_challenge_method=S256"} {
+		if !strings.Contains(u, want) {
+			t.Errorf("authorization url %s is missing %s", u, want)
+		}
+	}
+}
+
+func TestExchangeAndVerify(t *testing.T) {
+	iss := oidctest.NewIssuer("chirpy", "secret")
+	defer iss.Close()
+	p := newProvider(iss)
+	ctx := context.Background()
+
+	code := iss.IssueCode(auth.PKCEChallenge(verifier), iss.Claims("alice", "nonce-1"))
+	raw, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	claims, err := p.VerifyIDToken(ctx, raw, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims.Subject != "alice" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	_, err = p.Exchange(ctx, code, verifier)
+	if err == nil {
+		t.Errorf("code could be exchanged twice")
+	}
+	code = iss.IssueCode(auth.PKCEChallenge(verifier), iss.Claims("alice", "nonce-1"))
+	_, err = p.Exchange(ctx, code, strings.Repeat("x", 48))
+	if err == nil {
+		t.Errorf("code was exchanged with the wrong verifier")
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	iss := oidctest.NewIssuer("chirpy", "secret")
+	defer iss.Close()
+	p := newProvider(iss)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{"wrong nonce", func() string {
+			return iss.Sign(iss.Claims("alice", "other-nonce"))
+		}},
+		{"missing nonce", func() string {
+			c := iss.Claims("alice", "nonce-1")
+			delete(c, "nonce")
+			return iss.Sign(c)
+		}},
+		{"wrong issuer", func() string {
+			c := iss.Claims("alice", "nonce-1")
+			c["iss"] = "https://evil.example.com"
+			return iss.Sign(c)
+		}},
+		{"wrong audience", func() string {
+			c := iss.Claims("alice", "nonce-1")
+			c["aud"] = "someone-else"
+			return iss.Sign(c)
+		}},
+		{"expired", func() string {
+			c := iss.Claims("alice", "nonce-1")
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+			return iss.Sign(c)
+		}},
+		{"no expiry", func() string {
+			c := iss.Claims("alice", "nonce-1")
+			delete(c, "exp")
+			return iss.Sign(c)
+		}},
+		{"no subject", func() string {
+			return iss.Sign(iss.Claims("", "nonce-1"))
+		}},
+		{"foreign key", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, iss.Claims("alice", "nonce-1"))
+			token.Header["kid"] = oidctest.KeyID
+			signed, _ := token.SignedString(otherKey)
+			return signed
+		}},
+		{"hmac", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, iss.Claims("alice", "nonce-1"))
+			signed, _ := token.SignedString([]byte("secret"))
+			return signed
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.VerifyIDToken(context.Background(), tt.token(), "nonce-1")
+			if err == nil {
+				t.Errorf("token was accepted")
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	iss := oidctest.NewIssuer("chirpy", "secret")
+	defer iss.Close()
+
+	p := oidc.NewProvider(iss.URL+"/", "chirpy", "secret", "http://chirpy.test/cb")
+	_, err := p.AuthCodeURL(context.Background(), "s", "n", "c")
+	if err != nil {
+		t.Fatalf("trailing slash should be ignored: %v", err)
+	}
+
+	iss.DiscoveryIssuer = "https://evil.example.com"
+	_, err = newProvider(iss).AuthCodeURL(context.Background(), "s", "n", "c")
+	if err == nil {
+		t.Errorf("discovery naming a different issuer was accepted")
+	}
+}
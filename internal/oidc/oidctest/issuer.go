@@ -0,0 +1,176 @@
+// Package oidctest provides an in-process OpenID Connect provider for tests.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const KeyID = "oidctest"
+
+type pendingCode struct {
+	challenge string
+	idToken   string
+}
+
+// Issuer serves discovery, a JWKS with a single RS256 key and a token
+// endpoint. ID tokens are registered up front with IssueCode and handed out
+// once for the matching code.
+type Issuer struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	// DiscoveryIssuer replaces the issuer named in the discovery document.
+	DiscoveryIssuer string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]pendingCode
+}
+
+func NewIssuer(clientID, clientSecret string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	iss := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		codes:        map[string]pendingCode{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", iss.discoveryHandler)
+	mux.HandleFunc("GET /jwks", iss.jwksHandler)
+	mux.HandleFunc("POST /token", iss.tokenHandler)
+	iss.Server = httptest.NewServer(mux)
+	return iss
+}
+
+// Claims returns valid ID token claims for subject and nonce. Tests change
+// single entries to produce broken tokens.
+func (iss *Issuer) Claims(subject, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            iss.URL,
+		"aud":            iss.ClientID,
+		"sub":            subject,
+		"nonce":          nonce,
+		"email":          subject + "@example.com",
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+// Sign signs claims with the published key.
+func (iss *Issuer) Sign(claims jwt.Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+	signed, err := token.SignedString(iss.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// IssueCode registers an authorization code that the token endpoint trades
+// for the signed claims. A non-empty codeChallenge is checked against the
+// S256 code_verifier of the token request.
+func (iss *Issuer) IssueCode(codeChallenge string, claims jwt.Claims) string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	code := base64.RawURLEncoding.EncodeToString(b)
+
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.codes[code] = pendingCode{challenge: codeChallenge, idToken: iss.Sign(claims)}
+	return code
+}
+
+func (iss *Issuer) discoveryHandler(w http.ResponseWriter, req *http.Request) {
+	issuer := iss.URL
+	if iss.DiscoveryIssuer != "" {
+		issuer = iss.DiscoveryIssuer
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": iss.URL + "/authorize",
+		"token_endpoint":         iss.URL + "/token",
+		"jwks_uri":               iss.URL + "/jwks",
+	})
+}
+
+func (iss *Issuer) jwksHandler(w http.ResponseWriter, req *http.Request) {
+	pub := iss.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (iss *Issuer) tokenHandler(w http.ResponseWriter, req *http.Request) {
+	id, secret, ok := req.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	}
+	if !ok || id != iss.ClientID || secret != iss.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	err := req.ParseForm()
+	if err != nil || req.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	iss.mu.Lock()
+	pending, ok := iss.codes[req.PostForm.Get("code")]
+	delete(iss.codes, req.PostForm.Get("code"))
+	iss.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if pending.challenge != "" {
+		sum := sha256.Sum256([]byte(req.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != pending.challenge {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code_verifier mismatch"})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "unused",
+		"token_type":   "Bearer",
+		"id_token":     pending.idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(payload)
+}
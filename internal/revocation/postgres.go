@@ -0,0 +1,35 @@
+package revocation
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// PostgresStore keeps the "not before" time on the users table and the
+// denylist in revoked_jwts, so all replicas see the same revocations.
+type PostgresStore struct {
+	Db *database.Queries
+}
+
+func (s *PostgresStore) InvalidateTokens(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	return s.Db.InvalidateUserTokens(ctx, database.InvalidateUserTokensParams{
+		ID:               userID,
+		TokensValidAfter: sql.NullTime{Time: at, Valid: true},
+	})
+}
+
+func (s *PostgresStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return s.Db.IsJWTRevoked(ctx, tokenID)
+}
+
+func (s *PostgresStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	err := s.Db.RevokeJWT(ctx, database.RevokeJWTParams{Jti: tokenID, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+	return s.Db.DeleteExpiredRevokedJWTs(ctx)
+}
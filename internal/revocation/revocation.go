@@ -0,0 +1,122 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// Store persists revoked token ids and the per user "not before" time.
+type Store interface {
+	InvalidateTokens(ctx context.Context, userID uuid.UUID, at time.Time) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+}
+
+type cachedRevoked struct {
+	revoked bool
+	until   time.Time
+}
+
+// List answers denylist lookups for every request from a small in memory
+// cache. Revocations made through the List apply at once, revocations made by
+// other replicas are picked up after CacheTTL.
+type List struct {
+	Store    Store
+	CacheTTL time.Duration
+
+	mu        sync.Mutex
+	denylist  map[string]cachedRevoked
+	lastSweep time.Time
+}
+
+func NewList(store Store) *List {
+	return &List{
+		Store:    store,
+		CacheTTL: 30 * time.Second,
+		denylist: map[string]cachedRevoked{},
+	}
+}
+
+// CheckToken rejects tokens that were revoked by id or issued before the last
+// security event of their user. validAfter comes from the user row, which
+// the caller loads for every request anyway.
+func (l *List) CheckToken(ctx context.Context, tokenID string, issuedAt, validAfter time.Time) error {
+	if issuedAt.Before(validAfter) {
+		return ErrTokenRevoked
+	}
+	if tokenID == "" {
+		return nil
+	}
+	revoked, err := l.isRevoked(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// InvalidateUser rejects every token of the user issued until now. JWTs only
+// carry whole seconds, so the time is truncated to keep tokens issued right
+// after the event valid.
+func (l *List) InvalidateUser(ctx context.Context, userID uuid.UUID) error {
+	return l.Store.InvalidateTokens(ctx, userID, time.Now().Truncate(time.Second))
+}
+
+// Revoke puts a single token on the denylist until it expires on its own.
+func (l *List) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	err := l.Store.Revoke(ctx, tokenID, expiresAt)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.denylist[tokenID] = cachedRevoked{revoked: true, until: expiresAt}
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *List) isRevoked(ctx context.Context, tokenID string) (bool, error) {
+	now := time.Now()
+	l.mu.Lock()
+	l.sweep(now)
+	cached, ok := l.denylist[tokenID]
+	l.mu.Unlock()
+	if ok && now.Before(cached.until) {
+		return cached.revoked, nil
+	}
+
+	revoked, err := l.Store.IsRevoked(ctx, tokenID)
+	if err != nil {
+		return false, err
+	}
+	// Revoked entries stay until the token expired anyway, misses are
+	// asked again after CacheTTL.
+	until := now.Add(l.CacheTTL)
+	if revoked {
+		until = now.Add(time.Hour)
+	}
+	l.mu.Lock()
+	l.denylist[tokenID] = cachedRevoked{revoked: revoked, until: until}
+	l.mu.Unlock()
+	return revoked, nil
+}
+
+// sweep drops stale cache entries once a minute. It needs l.mu.
+func (l *List) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for id, cached := range l.denylist {
+		if !now.Before(cached.until) {
+			delete(l.denylist, id)
+		}
+	}
+}
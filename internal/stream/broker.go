@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Event is an outbox event as it is passed on to live connections.
+type Event struct {
+	ID     int64
+	Type   string
+	UserID uuid.NullUUID
+	Data   json.RawMessage
+}
+
+var (
+	ErrTooSlow = errors.New("stream: subscriber fell behind")
+	ErrClosed  = errors.New("stream: broker closed")
+)
+
+// Broker fans events out to the subscribers of this process. Publish never
+// blocks: a subscriber whose buffer is full is dropped and has to reconnect,
+// so one slow client cannot hold up the others.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+type Subscription struct {
+	broker *Broker
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: map[*Subscription]struct{}{}}
+}
+
+// Subscribe registers a subscriber that buffers up to buffer events.
+func (b *Broker) Subscribe(buffer int) *Subscription {
+	sub := &Subscription{
+		broker: b,
+		events: make(chan Event, buffer),
+		done:   make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		select {
+		case sub.events <- event:
+		default:
+			delete(b.subs, sub)
+			sub.close(ErrTooSlow)
+		}
+	}
+}
+
+// Close drops all subscribers, for example on shutdown.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		sub.close(ErrClosed)
+	}
+}
+
+// Events delivers the events published after Subscribe.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed once the subscriber was dropped or unsubscribed.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) Unsubscribe() {
+	s.broker.mu.Lock()
+	delete(s.broker.subs, s)
+	s.broker.mu.Unlock()
+	s.close(nil)
+}
+
+// Err tells why the subscription ended once Done is closed: ErrTooSlow,
+// ErrClosed or nil after Unsubscribe.
+func (s *Subscription) Err() error {
+	<-s.done
+	return s.err
+}
+
+func (s *Subscription) close(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
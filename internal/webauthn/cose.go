@@ -0,0 +1,95 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE algorithm identifiers offered in the creation options.
+const (
+	algES256 = -7
+	algEdDSA = -8
+	algRS256 = -257
+)
+
+type publicKey struct {
+	alg int
+	key crypto.PublicKey
+}
+
+func parsePublicKey(raw []byte) (*publicKey, error) {
+	var head struct {
+		Kty int `cbor:"1,keyasint"`
+		Alg int `cbor:"3,keyasint"`
+	}
+	err := cbor.Unmarshal(raw, &head)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: invalid COSE key: %w", err)
+	}
+
+	switch head.Alg {
+	case algES256:
+		var k struct {
+			Crv int    `cbor:"-1,keyasint"`
+			X   []byte `cbor:"-2,keyasint"`
+			Y   []byte `cbor:"-3,keyasint"`
+		}
+		if err := cbor.Unmarshal(raw, &k); err != nil || head.Kty != 2 || k.Crv != 1 {
+			return nil, errors.New("webauthn: invalid ES256 key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(k.X), Y: new(big.Int).SetBytes(k.Y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("webauthn: ES256 key not on curve")
+		}
+		return &publicKey{alg: head.Alg, key: pub}, nil
+	case algEdDSA:
+		var k struct {
+			Crv int    `cbor:"-1,keyasint"`
+			X   []byte `cbor:"-2,keyasint"`
+		}
+		if err := cbor.Unmarshal(raw, &k); err != nil || head.Kty != 1 || k.Crv != 6 || len(k.X) != ed25519.PublicKeySize {
+			return nil, errors.New("webauthn: invalid EdDSA key")
+		}
+		return &publicKey{alg: head.Alg, key: ed25519.PublicKey(k.X)}, nil
+	case algRS256:
+		var k struct {
+			N []byte `cbor:"-1,keyasint"`
+			E []byte `cbor:"-2,keyasint"`
+		}
+		if err := cbor.Unmarshal(raw, &k); err != nil || head.Kty != 3 || len(k.N) == 0 || len(k.E) == 0 {
+			return nil, errors.New("webauthn: invalid RS256 key")
+		}
+		return &publicKey{alg: head.Alg, key: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(k.N),
+			E: int(new(big.Int).SetBytes(k.E).Int64()),
+		}}, nil
+	}
+	return nil, fmt.Errorf("webauthn: unsupported algorithm %d", head.Alg)
+}
+
+func (k *publicKey) verify(data, sig []byte) error {
+	var ok bool
+	switch pub := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(pub, digest[:], sig)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, data, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !ok {
+		return errors.New("webauthn: invalid signature")
+	}
+	return nil
+}
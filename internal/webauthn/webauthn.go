@@ -0,0 +1,335 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	ErrChallengeMismatch   = errors.New("webauthn: challenge mismatch")
+	ErrOriginMismatch      = errors.New("webauthn: origin mismatch")
+	ErrClonedAuthenticator = errors.New("webauthn: sign counter did not increase, authenticator may be cloned")
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// RelyingParty verifies the registration and assertion ceremonies of passkeys
+// for one site. Attestation is not evaluated (the options ask for "none"), so
+// software authenticators work the same as hardware keys.
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// NewRelyingParty derives the relying party ID from the host of the origin
+// unless one is given explicitly.
+func NewRelyingParty(origin, id, name string) (*RelyingParty, error) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("webauthn: invalid origin %q", origin)
+	}
+	if id == "" {
+		id = u.Hostname()
+	}
+	return &RelyingParty{ID: id, Name: name, Origin: u.Scheme + "://" + u.Host}, nil
+}
+
+// Credential is what has to be stored after a registration.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+type CredentialDescriptor struct {
+	Type string       `json:"type"`
+	ID   URLEncodedID `json:"id"`
+}
+
+// URLEncodedID is a byte string that is base64url encoded in JSON, the
+// encoding browsers use for ids in the serialized credential.
+type URLEncodedID []byte
+
+func (b URLEncodedID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *URLEncodedID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := decodeURL(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+type User struct {
+	ID          URLEncodedID `json:"id"`
+	Name        string       `json:"name"`
+	DisplayName string       `json:"displayName"`
+}
+
+type CreationOptions struct {
+	Challenge          string                 `json:"challenge"`
+	RP                 map[string]string      `json:"rp"`
+	User               User                   `json:"user"`
+	PubKeyCredParams   []map[string]any       `json:"pubKeyCredParams"`
+	Timeout            int                    `json:"timeout"`
+	ExcludeCredentials []CredentialDescriptor `json:"excludeCredentials"`
+	Attestation        string                 `json:"attestation"`
+	AuthenticatorSel   map[string]string      `json:"authenticatorSelection"`
+}
+
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int                    `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the JSON form of the PublicKeyCredential returned
+// by navigator.credentials.create().
+type RegistrationResponse struct {
+	ID       string       `json:"id"`
+	RawID    URLEncodedID `json:"rawId"`
+	Type     string       `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedID `json:"clientDataJSON"`
+		AttestationObject URLEncodedID `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.get().
+type AssertionResponse struct {
+	ID       string       `json:"id"`
+	RawID    URLEncodedID `json:"rawId"`
+	Type     string       `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedID `json:"clientDataJSON"`
+		AuthenticatorData URLEncodedID `json:"authenticatorData"`
+		Signature         URLEncodedID `json:"signature"`
+		UserHandle        URLEncodedID `json:"userHandle"`
+	} `json:"response"`
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// NewChallenge returns a random base64url challenge for one ceremony.
+func NewChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (rp *RelyingParty) CreationOptions(challenge string, user User, exclude [][]byte) CreationOptions {
+	opts := CreationOptions{
+		Challenge: challenge,
+		RP:        map[string]string{"id": rp.ID, "name": rp.Name},
+		User:      user,
+		PubKeyCredParams: []map[string]any{
+			{"type": "public-key", "alg": algES256},
+			{"type": "public-key", "alg": algEdDSA},
+			{"type": "public-key", "alg": algRS256},
+		},
+		Timeout:            300000,
+		ExcludeCredentials: []CredentialDescriptor{},
+		Attestation:        "none",
+		AuthenticatorSel: map[string]string{
+			"residentKey":      "required",
+			"userVerification": "preferred",
+		},
+	}
+	for _, id := range exclude {
+		opts.ExcludeCredentials = append(opts.ExcludeCredentials, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return opts
+}
+
+// RequestOptions leaves allowCredentials empty so the authenticator offers
+// its discoverable credentials and no username has to be entered.
+func (rp *RelyingParty) RequestOptions(challenge string) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          300000,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "preferred",
+	}
+}
+
+// VerifyRegistration checks a registration response against the challenge
+// issued for it and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(res RegistrationResponse, challenge string) (*Credential, error) {
+	if res.Type != "public-key" {
+		return nil, errors.New("webauthn: unexpected credential type")
+	}
+	err := rp.verifyClientData(res.Response.ClientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	var att struct {
+		Fmt      string         `cbor:"fmt"`
+		AttStmt  map[string]any `cbor:"attStmt"`
+		AuthData []byte         `cbor:"authData"`
+	}
+	err = cbor.Unmarshal(res.Response.AttestationObject, &att)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: invalid attestation object: %w", err)
+	}
+	if att.Fmt != "none" {
+		return nil, fmt.Errorf("webauthn: unsupported attestation format %q", att.Fmt)
+	}
+
+	data, err := rp.parseAuthenticatorData(att.AuthData)
+	if err != nil {
+		return nil, err
+	}
+	if data.flags&flagAttested == 0 {
+		return nil, errors.New("webauthn: no attested credential data")
+	}
+	if !bytes.Equal(data.credentialID, res.RawID) {
+		return nil, errors.New("webauthn: credential id mismatch")
+	}
+	if _, err := parsePublicKey(data.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{ID: data.credentialID, PublicKey: data.publicKey, SignCount: data.signCount}, nil
+}
+
+// VerifyAssertion checks an assertion made with cred and returns the new sign
+// counter. A counter that did not increase means two authenticators share the
+// key, which is reported as ErrClonedAuthenticator.
+func (rp *RelyingParty) VerifyAssertion(res AssertionResponse, challenge string, cred Credential) (uint32, error) {
+	if res.Type != "public-key" {
+		return 0, errors.New("webauthn: unexpected credential type")
+	}
+	if !bytes.Equal(res.RawID, cred.ID) {
+		return 0, errors.New("webauthn: credential id mismatch")
+	}
+	err := rp.verifyClientData(res.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+	data, err := rp.parseAuthenticatorData(res.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientHash := sha256.Sum256(res.Response.ClientDataJSON)
+	signed := append(append([]byte{}, res.Response.AuthenticatorData...), clientHash[:]...)
+	err = key.verify(signed, res.Response.Signature)
+	if err != nil {
+		return 0, err
+	}
+
+	// Authenticators without a counter always send 0.
+	if (data.signCount != 0 || cred.SignCount != 0) && data.signCount <= cred.SignCount {
+		return 0, ErrClonedAuthenticator
+	}
+	return data.signCount, nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, typ, challenge string) error {
+	var cd clientData
+	err := json.Unmarshal(raw, &cd)
+	if err != nil {
+		return fmt.Errorf("webauthn: invalid client data: %w", err)
+	}
+	if cd.Type != typ {
+		return fmt.Errorf("webauthn: unexpected client data type %q", cd.Type)
+	}
+	if cd.Challenge != challenge {
+		return ErrChallengeMismatch
+	}
+	if cd.Origin != rp.Origin {
+		return ErrOriginMismatch
+	}
+	return nil
+}
+
+func (rp *RelyingParty) parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("webauthn: authenticator data too short")
+	}
+	data := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data.rpIDHash, rpIDHash[:]) {
+		return nil, errors.New("webauthn: relying party id mismatch")
+	}
+	if data.flags&flagUserPresent == 0 {
+		return nil, errors.New("webauthn: user not present")
+	}
+
+	if data.flags&flagAttested != 0 {
+		rest := raw[37:]
+		if len(rest) < 18 {
+			return nil, errors.New("webauthn: attested credential data too short")
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return nil, errors.New("webauthn: credential id too short")
+		}
+		data.credentialID = rest[:idLen]
+		var key cbor.RawMessage
+		_, err := cbor.UnmarshalFirst(rest[idLen:], &key)
+		if err != nil {
+			return nil, fmt.Errorf("webauthn: invalid credential public key: %w", err)
+		}
+		data.publicKey = []byte(key)
+	}
+	return data, nil
+}
+
+func decodeURL(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		// Some clients keep the padding.
+		return base64.URLEncoding.DecodeString(s)
+	}
+	return b, nil
+}
@@ -0,0 +1,145 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DmitrijP/my-go-server/internal/webauthn"
+	"github.com/DmitrijP/my-go-server/internal/webauthn/webauthntest"
+)
+
+func newRelyingParty(t *testing.T) *webauthn.RelyingParty {
+	t.Helper()
+	rp, err := webauthn.NewRelyingParty("https://chirpy.example.com", "", "Chirpy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rp
+}
+
+func challenge(t *testing.T) string {
+	t.Helper()
+	c, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func register(t *testing.T, rp *webauthn.RelyingParty, a *webauthntest.Authenticator) webauthn.Credential {
+	t.Helper()
+	c := challenge(t)
+	cred, err := rp.VerifyRegistration(a.Register(c), c)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return *cred
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	rp := newRelyingParty(t)
+	a := webauthntest.NewAuthenticator(rp.Origin, rp.ID)
+	cred := register(t, rp, a)
+
+	for i := range 3 {
+		c := challenge(t)
+		count, err := rp.VerifyAssertion(a.Login(c), c, cred)
+		if err != nil {
+			t.Fatalf("login %d: %v", i+1, err)
+		}
+		if count != cred.SignCount+1 {
+			t.Errorf("login %d returned counter %d after %d", i+1, count, cred.SignCount)
+		}
+		cred.SignCount = count
+	}
+}
+
+func TestRegistrationRejects(t *testing.T) {
+	rp := newRelyingParty(t)
+
+	t.Run("challenge", func(t *testing.T) {
+		a := webauthntest.NewAuthenticator(rp.Origin, rp.ID)
+		_, err := rp.VerifyRegistration(a.Register(challenge(t)), challenge(t))
+		if !errors.Is(err, webauthn.ErrChallengeMismatch) {
+			t.Errorf("got %v, want %v", err, webauthn.ErrChallengeMismatch)
+		}
+	})
+	t.Run("origin", func(t *testing.T) {
+		a := webauthntest.NewAuthenticator("https://evil.example.com", rp.ID)
+		c := challenge(t)
+		_, err := rp.VerifyRegistration(a.Register(c), c)
+		if !errors.Is(err, webauthn.ErrOriginMismatch) {
+			t.Errorf("got %v, want %v", err, webauthn.ErrOriginMismatch)
+		}
+	})
+	t.Run("relying party", func(t *testing.T) {
+		a := webauthntest.NewAuthenticator(rp.Origin, "evil.example.com")
+		c := challenge(t)
+		_, err := rp.VerifyRegistration(a.Register(c), c)
+		if err == nil {
+			t.Errorf("credential for another relying party was accepted")
+		}
+	})
+}
+
+func TestLoginRejects(t *testing.T) {
+	rp := newRelyingParty(t)
+	a := webauthntest.NewAuthenticator(rp.Origin, rp.ID)
+	cred := register(t, rp, a)
+
+	t.Run("challenge", func(t *testing.T) {
+		_, err := rp.VerifyAssertion(a.Login(challenge(t)), challenge(t), cred)
+		if !errors.Is(err, webauthn.ErrChallengeMismatch) {
+			t.Errorf("got %v, want %v", err, webauthn.ErrChallengeMismatch)
+		}
+	})
+	t.Run("other key", func(t *testing.T) {
+		other := webauthntest.NewAuthenticator(rp.Origin, rp.ID)
+		other.CredentialID = cred.ID
+		c := challenge(t)
+		_, err := rp.VerifyAssertion(other.Login(c), c, cred)
+		if err == nil {
+			t.Errorf("assertion signed with another key was accepted")
+		}
+	})
+	t.Run("tampered", func(t *testing.T) {
+		c := challenge(t)
+		res := a.Login(c)
+		res.Response.Signature[len(res.Response.Signature)-1] ^= 0xff
+		_, err := rp.VerifyAssertion(res, c, cred)
+		if err == nil {
+			t.Errorf("tampered signature was accepted")
+		}
+	})
+	t.Run("cloned", func(t *testing.T) {
+		clone := *a
+		c := challenge(t)
+		count, err := rp.VerifyAssertion(a.Login(c), c, cred)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cred := cred
+		cred.SignCount = count
+
+		c = challenge(t)
+		_, err = rp.VerifyAssertion(clone.Login(c), c, cred)
+		if !errors.Is(err, webauthn.ErrClonedAuthenticator) {
+			t.Errorf("got %v, want %v", err, webauthn.ErrClonedAuthenticator)
+		}
+	})
+}
+
+func TestCounterlessAuthenticator(t *testing.T) {
+	rp := newRelyingParty(t)
+	a := webauthntest.NewAuthenticator(rp.Origin, rp.ID)
+	a.Counterless = true
+	cred := register(t, rp, a)
+
+	for range 2 {
+		c := challenge(t)
+		count, err := rp.VerifyAssertion(a.Login(c), c, cred)
+		if err != nil || count != 0 {
+			t.Fatalf("counterless login failed: %d %v", count, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package webauthntest provides a software authenticator that answers the
+// passkey ceremonies the way a browser would, for tests.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/DmitrijP/my-go-server/internal/webauthn"
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// Authenticator holds one ES256 credential. Copying the value gives a clone
+// that shares key and counter state at the time of the copy.
+type Authenticator struct {
+	Origin string
+	RPID   string
+	// SignCount is the counter sent with the last assertion. It stays at
+	// zero when Counterless is set, like authenticators without a counter.
+	SignCount   uint32
+	Counterless bool
+
+	CredentialID []byte
+	key          *ecdsa.PrivateKey
+}
+
+func NewAuthenticator(origin, rpID string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		panic(err)
+	}
+	return &Authenticator{Origin: origin, RPID: rpID, CredentialID: id, key: key}
+}
+
+// Register answers navigator.credentials.create() for challenge.
+func (a *Authenticator) Register(challenge string) webauthn.RegistrationResponse {
+	clientData := a.clientData("webauthn.create", challenge)
+
+	coseKey, err := cbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		panic(err)
+	}
+	authData := a.authData(flagUserPresent|flagUserVerified|flagAttested, a.SignCount)
+	authData = append(authData, make([]byte, 16)...) // aaguid
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.CredentialID)))
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, coseKey...)
+
+	attestation, err := cbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	var res webauthn.RegistrationResponse
+	res.ID = base64.RawURLEncoding.EncodeToString(a.CredentialID)
+	res.RawID = a.CredentialID
+	res.Type = "public-key"
+	res.Response.ClientDataJSON = clientData
+	res.Response.AttestationObject = attestation
+	return res
+}
+
+// Login answers navigator.credentials.get() for challenge and advances the
+// counter.
+func (a *Authenticator) Login(challenge string) webauthn.AssertionResponse {
+	if !a.Counterless {
+		a.SignCount++
+	}
+	clientData := a.clientData("webauthn.get", challenge)
+	authData := a.authData(flagUserPresent|flagUserVerified, a.SignCount)
+
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	var res webauthn.AssertionResponse
+	res.ID = base64.RawURLEncoding.EncodeToString(a.CredentialID)
+	res.RawID = a.CredentialID
+	res.Type = "public-key"
+	res.Response.ClientDataJSON = clientData
+	res.Response.AuthenticatorData = authData
+	res.Response.Signature = sig
+	return res
+}
+
+func (a *Authenticator) clientData(typ, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": challenge,
+		"origin":    a.Origin,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func (a *Authenticator) authData(flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
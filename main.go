@@ -1,14 +1,31 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/DmitrijP/my-go-server/handlers"
+	"github.com/DmitrijP/my-go-server/internal/auth"
 	"github.com/DmitrijP/my-go-server/internal/database"
+	"github.com/DmitrijP/my-go-server/internal/lockout"
+	"github.com/DmitrijP/my-go-server/internal/mail"
+	"github.com/DmitrijP/my-go-server/internal/oidc"
+	"github.com/DmitrijP/my-go-server/internal/revocation"
+	"github.com/DmitrijP/my-go-server/internal/stream"
+	"github.com/DmitrijP/my-go-server/internal/webauthn"
+	"github.com/DmitrijP/my-go-server/internal/webhook"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -22,48 +39,329 @@ func main() {
 	jwt_secret := os.Getenv("JWT_SECRET")
 	polka_key := os.Getenv("POLKA_KEY")
 
+	argon2Params := auth.DefaultArgon2Params
+	if v := os.Getenv("ARGON2_MEMORY"); v != "" {
+		m, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			log.Fatalf("Invalid ARGON2_MEMORY: %v", err)
+		}
+		argon2Params.Memory = uint32(m)
+	}
+	if v := os.Getenv("ARGON2_ITERATIONS"); v != "" {
+		t, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			log.Fatalf("Invalid ARGON2_ITERATIONS: %v", err)
+		}
+		argon2Params.Iterations = uint32(t)
+	}
+	if v := os.Getenv("ARGON2_PARALLELISM"); v != "" {
+		p, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			log.Fatalf("Invalid ARGON2_PARALLELISM: %v", err)
+		}
+		argon2Params.Parallelism = uint8(p)
+	}
+	if err := auth.SetArgon2Params(argon2Params); err != nil {
+		log.Fatalf("Password hashing setup error: %v", err)
+	}
+
+	passwordPolicy := auth.DefaultPasswordPolicy
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid PASSWORD_MIN_LENGTH: %v", err)
+		}
+		passwordPolicy.MinLength = l
+	}
+	if v := os.Getenv("PASSWORD_MIN_ENTROPY"); v != "" {
+		e, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Fatalf("Invalid PASSWORD_MIN_ENTROPY: %v", err)
+		}
+		passwordPolicy.MinEntropy = e
+	}
+	passwordPolicy.BreachedCorpus = os.Getenv("PASSWORD_BREACHED_CORPUS")
+
 	dbURL := os.Getenv("DB_URL")
 	db, _ := sql.Open("postgres", dbURL)
 	dbQueries := database.New(db)
 
 	var cfg handlers.ApiConfig
 	cfg.Db = *dbQueries
-	cfg.Jwt_secret = jwt_secret
+	cfg.SqlDB = db
+	cfg.JwtKeys = auth.NewKeySet(jwt_secret)
+	cfg.JwtKeys.AcceptHS256 = os.Getenv("JWT_ACCEPT_HS256") == "true"
+	if keysDir := os.Getenv("JWT_KEYS_DIR"); keysDir != "" {
+		err := cfg.JwtKeys.LoadKeys(keysDir, os.Getenv("JWT_ACTIVE_KID"))
+		if err != nil {
+			log.Fatalf("JWT key setup error: %v", err)
+		}
+	}
+	cfg.Revocations = revocation.NewList(&revocation.PostgresStore{Db: dbQueries})
 	cfg.PolkaKey = polka_key
+	cfg.PolkaAllowAPIKey = os.Getenv("POLKA_ALLOW_API_KEY") != "false"
+	if v := os.Getenv("POLKA_WEBHOOK_SECRETS"); v != "" {
+		var secrets [][]byte
+		for _, secret := range strings.Split(v, ",") {
+			if secret = strings.TrimSpace(secret); secret != "" {
+				secrets = append(secrets, []byte(secret))
+			}
+		}
+		cfg.PolkaVerifier = webhook.NewVerifier(secrets)
+	}
+	cfg.PasswordPolicy = passwordPolicy
+	for _, v := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(v)
+			if addrErr != nil {
+				log.Fatalf("Invalid TRUSTED_PROXIES entry %q: %v", v, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, prefix.Masked())
+	}
+
+	var limitStore lockout.Store
+	switch os.Getenv("LOGIN_LIMIT_STORE") {
+	case "", "memory":
+		limitStore = lockout.NewMemoryStore()
+	case "postgres":
+		limitStore = &lockout.PostgresStore{Db: dbQueries}
+	default:
+		log.Fatalf("Unknown LOGIN_LIMIT_STORE: %s", os.Getenv("LOGIN_LIMIT_STORE"))
+	}
+	cfg.LoginLimiter = lockout.NewLimiter(limitStore)
+	cfg.MailLimiter = lockout.NewMailLimiter(limitStore)
+	cfg.CeremonyLimiter = lockout.NewCeremonyLimiter(limitStore)
+
+	cfg.RequireVerifiedEmail = os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+
+	if v := os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid ACCOUNT_DELETION_GRACE_DAYS: %v", err)
+		}
+		cfg.AccountDeletionGrace = time.Duration(days) * 24 * time.Hour
+	}
+
+	cfg.BaseURL = os.Getenv("BASE_URL")
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "http://localhost:8080"
+	}
+
+	if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+		cfg.Mailer = &mail.SMTPMailer{
+			Host:     smtpHost,
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	} else {
+		logMailer, err := mail.NewLogMailer(os.Getenv("MAIL_LOG_FILE"))
+		if err != nil {
+			log.Fatalf("Mailer setup error: %v", err)
+		}
+		cfg.Mailer = logMailer
+	}
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		cfg.OIDC = oidc.NewProvider(
+			issuer,
+			os.Getenv("OIDC_CLIENT_ID"),
+			os.Getenv("OIDC_CLIENT_SECRET"),
+			cfg.BaseURL+"/api/login/oidc/callback",
+		)
+	}
+
+	cfg.ExportDir = os.Getenv("EXPORT_DIR")
+	if cfg.ExportDir == "" {
+		cfg.ExportDir = "./exports"
+	}
+	cfg.ImportDir = os.Getenv("IMPORT_DIR")
+	if cfg.ImportDir == "" {
+		cfg.ImportDir = "./imports"
+	}
+	// The download links are the only authorization of an export, so a
+	// weak or shared key would let anyone forge them. Without a proper key
+	// the export routes answer 503 and the rest of the server runs.
+	cfg.ExportSigningKey = []byte(os.Getenv("EXPORT_SIGNING_KEY"))
+	if len(cfg.ExportSigningKey) < 32 {
+		log.Printf("EXPORT_SIGNING_KEY is missing or shorter than 32 bytes, data exports are disabled")
+		cfg.ExportSigningKey = nil
+	}
+
+	cfg.Events = stream.NewBroker()
+	cfg.WebhookAllowInsecure = os.Getenv("WEBHOOK_ALLOW_INSECURE") == "true"
+	cfg.WebhookClient = webhook.NewClient(15*time.Second, cfg.WebhookAllowInsecure)
+
+	rp, err := webauthn.NewRelyingParty(cfg.BaseURL, os.Getenv("WEBAUTHN_RP_ID"), "Chirpy")
+	if err != nil {
+		log.Fatalf("Passkey setup error: %v", err)
+	}
+	cfg.WebAuthn = rp
+
+	requireScope := func(scope string, handler http.HandlerFunc) http.Handler {
+		return cfg.RequireAuth(handlers.RequireScope(scope, handler))
+	}
+	requireSession := func(handler http.HandlerFunc) http.Handler {
+		return cfg.RequireAuth(handlers.RequireSession(handler))
+	}
+	requireAdmin := func(handler http.HandlerFunc) http.Handler {
+		return cfg.RequireAuth(handlers.RequireRole("admin", handler))
+	}
+	optionalAuth := func(handler http.HandlerFunc) http.Handler {
+		return cfg.OptionalAuth(handler)
+	}
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /api/healthz", handlers.ReadinessHandler)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.JWKSHandler)
 
 	mux.HandleFunc("POST /api/polka/webhooks", cfg.PolkaWebhookHandler)
 
 	mux.HandleFunc("POST /api/login", cfg.LoginHandler)
+	mux.HandleFunc("POST /api/login/magic", cfg.MagicLinkRequestHandler)
+	mux.HandleFunc("GET /api/login/magic/{token}", cfg.MagicLinkLoginHandler)
+	mux.HandleFunc("GET /api/login/oidc", cfg.OIDCLoginHandler)
+	mux.HandleFunc("GET /api/login/oidc/callback", cfg.OIDCCallbackHandler)
+	mux.HandleFunc("POST /api/login/passkey/begin", cfg.PasskeyLoginBeginHandler)
+	mux.HandleFunc("POST /api/login/passkey/finish", cfg.PasskeyLoginFinishHandler)
 	mux.HandleFunc("POST /api/refresh", cfg.RefreshHandler)
 	mux.HandleFunc("POST /api/revoke", cfg.RevokeHandler)
+	mux.Handle("POST /api/logout", requireSession(cfg.LogoutHandler))
+
+	mux.HandleFunc("POST /api/password-reset/request", cfg.PasswordResetRequestHandler)
+	mux.HandleFunc("POST /api/password-reset/confirm", cfg.PasswordResetConfirmHandler)
 
 	mux.HandleFunc("POST /api/users", cfg.UsersHandler)
-	mux.HandleFunc("PUT /api/users", cfg.ChangeUserPasswordHandler)
+	mux.Handle("PUT /api/users", requireScope(auth.ScopeProfileWrite, cfg.ChangeUserPasswordHandler))
+	mux.Handle("DELETE /api/users/me", requireSession(cfg.DeleteAccountHandler))
+	mux.Handle("POST /api/users/me/deletion/cancel", requireSession(cfg.CancelAccountDeletionHandler))
+	mux.Handle("POST /api/users/me/export", requireSession(cfg.ExportHandler))
+	mux.HandleFunc("GET /api/exports/{jobID}", cfg.ExportDownloadHandler)
+	mux.Handle("GET /api/jobs/{jobID}", cfg.RequireAuth(http.HandlerFunc(cfg.GetJobHandler)))
+	mux.HandleFunc("POST /api/users/verify", cfg.EmailVerificationConfirmHandler)
+	mux.Handle("POST /api/users/verify/resend", requireScope(auth.ScopeProfileWrite, cfg.EmailVerificationResendHandler))
+	mux.Handle("PUT /api/users/me/username", requireScope(auth.ScopeProfileWrite, cfg.UpdateUsernameHandler))
+	mux.Handle("POST /api/users/{userID}/follow", requireScope(auth.ScopeProfileWrite, cfg.FollowUserHandler))
+	mux.Handle("DELETE /api/users/{userID}/follow", requireScope(auth.ScopeProfileWrite, cfg.UnfollowUserHandler))
+	mux.Handle("POST /api/users/{userID}/block", requireScope(auth.ScopeProfileWrite, cfg.BlockUserHandler))
+	mux.Handle("DELETE /api/users/{userID}/block", requireScope(auth.ScopeProfileWrite, cfg.UnblockUserHandler))
 
-	mux.HandleFunc("POST /api/chirps", cfg.ChirpsHandler)
-	mux.HandleFunc("GET /api/chirps", cfg.GetAllChirpsHandler)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.GetOneChirpsHandler)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.DeleteChirpHandler)
+	mux.Handle("POST /api/tokens", requireSession(cfg.CreateTokenHandler))
+	mux.Handle("GET /api/tokens", requireSession(cfg.ListTokensHandler))
+	mux.Handle("DELETE /api/tokens/{tokenID}", requireSession(cfg.RevokeTokenHandler))
+
+	mux.Handle("POST /api/passkeys/register/begin", requireSession(cfg.PasskeyRegisterBeginHandler))
+	mux.Handle("POST /api/passkeys/register/finish", requireSession(cfg.PasskeyRegisterFinishHandler))
+	mux.Handle("GET /api/passkeys", requireSession(cfg.ListPasskeysHandler))
+	mux.Handle("DELETE /api/passkeys/{passkeyID}", requireSession(cfg.DeletePasskeyHandler))
+
+	mux.Handle("GET /api/notifications", requireScope(auth.ScopeChirpsRead, cfg.ListNotificationsHandler))
+	mux.Handle("POST /api/notifications/read", requireScope(auth.ScopeProfileWrite, cfg.MarkNotificationsReadHandler))
+	mux.Handle("GET /api/notifications/preferences", requireScope(auth.ScopeChirpsRead, cfg.GetNotificationPreferencesHandler))
+	mux.Handle("PUT /api/notifications/preferences", requireScope(auth.ScopeProfileWrite, cfg.UpdateNotificationPreferencesHandler))
+
+	mux.Handle("POST /api/conversations", requireSession(cfg.CreateConversationHandler))
+	mux.Handle("GET /api/conversations", requireSession(cfg.ListConversationsHandler))
+	mux.Handle("POST /api/conversations/{conversationID}/messages", requireSession(cfg.SendMessageHandler))
+	mux.Handle("GET /api/conversations/{conversationID}/messages", requireSession(cfg.ListMessagesHandler))
+	mux.Handle("POST /api/conversations/{conversationID}/read", requireSession(cfg.MarkConversationReadHandler))
+	mux.Handle("POST /api/conversations/{conversationID}/leave", requireSession(cfg.LeaveConversationHandler))
+	mux.Handle("GET /api/users/me/dm-settings", requireSession(cfg.GetDmSettingsHandler))
+	mux.Handle("PUT /api/users/me/dm-settings", requireSession(cfg.UpdateDmSettingsHandler))
+
+	mux.Handle("POST /api/webhooks/endpoints", requireSession(cfg.CreateWebhookEndpointHandler))
+	mux.Handle("GET /api/webhooks/endpoints", requireSession(cfg.ListWebhookEndpointsHandler))
+	mux.Handle("DELETE /api/webhooks/endpoints/{endpointID}", requireSession(cfg.DeleteWebhookEndpointHandler))
+	mux.Handle("GET /api/webhooks/endpoints/{endpointID}/deliveries", requireSession(cfg.ListWebhookDeliveriesHandler))
+
+	mux.Handle("POST /api/oauth/clients", requireSession(cfg.CreateOAuthClientHandler))
+	mux.HandleFunc("GET /oauth/authorize", cfg.OAuthAuthorizeHandler)
+	mux.HandleFunc("POST /oauth/authorize", cfg.OAuthConsentHandler)
+	mux.HandleFunc("POST /oauth/token", cfg.OAuthTokenHandler)
+	mux.HandleFunc("POST /oauth/revoke", cfg.OAuthRevokeHandler)
+	mux.HandleFunc("POST /oauth/introspect", cfg.OAuthIntrospectHandler)
+
+	mux.Handle("POST /api/chirps", requireScope(auth.ScopeChirpsWrite, cfg.ChirpsHandler))
+	mux.Handle("POST /api/chirps/import", requireScope(auth.ScopeChirpsWrite, cfg.ImportChirpsHandler))
+	mux.Handle("GET /api/chirps", optionalAuth(cfg.GetAllChirpsHandler))
+	mux.Handle("GET /api/chirps/stream", optionalAuth(cfg.ChirpStreamHandler))
+	mux.Handle("GET /api/ws", requireScope(auth.ScopeChirpsRead, cfg.WebSocketHandler))
+	mux.Handle("GET /api/chirps/{chirpID}", optionalAuth(cfg.GetOneChirpsHandler))
+	mux.Handle("DELETE /api/chirps/{chirpID}", requireScope(auth.ScopeChirpsWrite, cfg.DeleteChirpHandler))
+	mux.Handle("POST /api/chirps/{chirpID}/likes", requireScope(auth.ScopeChirpsWrite, cfg.LikeChirpHandler))
+	mux.Handle("DELETE /api/chirps/{chirpID}/likes", requireScope(auth.ScopeChirpsWrite, cfg.UnlikeChirpHandler))
 
 	mux.HandleFunc("POST /admin/reset", cfg.MetricsReset)
 	mux.HandleFunc("GET /admin/metrics", cfg.MetricsShow)
+	mux.Handle("POST /admin/users/{userID}/suspend", requireAdmin(cfg.SuspendUserHandler))
+	mux.Handle("DELETE /admin/users/{userID}/suspend", requireAdmin(cfg.UnsuspendUserHandler))
+	mux.Handle("GET /admin/webhooks/events", requireAdmin(cfg.ListWebhookEventsHandler))
+	mux.Handle("POST /admin/webhooks/events/{eventID}/replay", requireAdmin(cfg.ReplayWebhookEventHandler))
+	mux.Handle("POST /admin/webhooks/endpoints", requireAdmin(cfg.AdminCreateWebhookEndpointHandler))
+	mux.Handle("GET /admin/webhooks/endpoints", requireAdmin(cfg.AdminListWebhookEndpointsHandler))
+	mux.Handle("DELETE /admin/webhooks/endpoints/{endpointID}", requireAdmin(cfg.AdminDeleteWebhookEndpointHandler))
+	mux.Handle("GET /admin/webhooks/endpoints/{endpointID}/deliveries", requireAdmin(cfg.AdminListWebhookDeliveriesHandler))
 
 	mux.Handle("/app/", cfg.MiddlewareMetricsInc(
 		http.StripPrefix("/app/",
 			http.FileServer(http.Dir("./html/")))))
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The workers stop when ctx is done, main waits for them so a job or
+	// delivery in flight is recorded before the process exits.
+	var workers sync.WaitGroup
+	for _, run := range []func(){
+		func() { cfg.RunAccountPurge(ctx, time.Hour) },
+		func() { cfg.RunJobs(ctx, 5*time.Second) },
+		func() { cfg.RunWebhookDeliveries(ctx, 5*time.Second) },
+		func() { cfg.RunEventStream(ctx, dbURL) },
+	} {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run()
+		}()
+	}
+
 	srv := &http.Server{
 		Handler: mux,
 		Addr:    ":8080",
 	}
+	// Streams and WebSockets end when the broker closes, the WebSockets with
+	// a "going away" close frame so clients reconnect to another replica.
+	srv.RegisterOnShutdown(cfg.Events.Close)
+
+	// ListenAndServe returns as soon as Shutdown starts, shutdownDone tells
+	// main when the open requests have finished.
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		fmt.Println("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Printf("Server shutdown error: %v", err)
+		}
+	}()
 
 	fmt.Println("Starting server on :8080")
-	err := srv.ListenAndServe()
-	if err != nil {
+	err = srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server start error: %v", err)
 	}
+	<-shutdownDone
+	workers.Wait()
+	fmt.Println("Server stopped")
 }
@@ -0,0 +1,21 @@
+-- name: BlockUser :execrows
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING;
+
+-- name: UnblockUser :execrows
+DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_id = sqlc.arg('user_a') AND blocked_id = sqlc.arg('user_b'))
+    OR (blocker_id = sqlc.arg('user_b') AND blocked_id = sqlc.arg('user_a'))
+);
+
+-- name: IsBlockedInConversation :one
+SELECT EXISTS (
+    SELECT 1 FROM blocks b
+    JOIN conversation_members m ON m.user_id = b.blocker_id
+    WHERE m.conversation_id = $1 AND b.blocked_id = $2
+);
\ No newline at end of file
@@ -1,9 +1,24 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
+WITH chirp AS (
+    INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to)
+    VALUES (
+        gen_random_uuid(), NOW(), NOW(), $1, $2, $3
+    )
+    RETURNING *
+), event AS (
+    INSERT INTO outbox_events (created_at, type, user_id, payload)
+    SELECT NOW(), 'chirp.created', user_id, jsonb_build_object('id', id, 'created_at', created_at, 'updated_at', updated_at, 'body', body, 'user_id', user_id, 'reply_to', reply_to)
+    FROM chirp
 )
-RETURNING *;
+SELECT * FROM chirp;
+
+-- name: CreateMentionEvents :many
+INSERT INTO outbox_events (created_at, type, user_id, payload)
+SELECT NOW(), 'user.mentioned', u.id, jsonb_build_object('chirp_id', c.id, 'user_id', u.id, 'author_id', c.user_id, 'body', c.body, 'created_at', c.created_at)
+FROM chirps c
+JOIN users u ON u.username = ANY(sqlc.arg('usernames')::TEXT[])
+WHERE c.id = sqlc.arg('chirp_id') AND u.id <> c.user_id
+RETURNING user_id;
 
 -- name: GetAllChirps :many
 SELECT * FROM chirps ORDER BY created_at ASC;
@@ -24,4 +39,17 @@ SELECT * FROM chirps WHERE id = $1 ORDER BY created_at ASC LIMIT 1;
 DELETE FROM chirps;
 
 -- name: DeleteChirp :exec
-DELETE FROM chirps WHERE id = $1;
\ No newline at end of file
+WITH deleted AS (
+    DELETE FROM chirps WHERE id = $1
+    RETURNING id, user_id, reply_to
+)
+INSERT INTO outbox_events (created_at, type, user_id, payload)
+SELECT NOW(), 'chirp.deleted', user_id, jsonb_build_object('id', id, 'user_id', user_id, 'reply_to', reply_to)
+FROM deleted;
+
+-- name: ImportChirp :execrows
+INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+SELECT gen_random_uuid(), $1, NOW(), $2, $3
+WHERE NOT EXISTS (
+    SELECT 1 FROM chirps WHERE user_id = $3 AND created_at = $1 AND body = $2
+);
\ No newline at end of file
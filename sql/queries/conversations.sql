@@ -0,0 +1,64 @@
+-- name: CreateConversation :one
+WITH conversation AS (
+    INSERT INTO conversations (id, created_at, updated_at, created_by)
+    VALUES (gen_random_uuid(), NOW(), NOW(), sqlc.arg('created_by'))
+    RETURNING *
+), members AS (
+    INSERT INTO conversation_members (conversation_id, user_id, joined_at)
+    SELECT conversation.id, member_id, NOW()
+    FROM conversation, unnest(sqlc.arg('member_ids')::UUID[]) AS member_id
+)
+SELECT * FROM conversation;
+
+-- name: LockDirectConversation :exec
+SELECT pg_advisory_xact_lock(hashtextextended(sqlc.arg('pair_key')::TEXT, 0));
+
+-- name: FindDirectConversation :one
+SELECT * FROM conversations
+WHERE id IN (
+    SELECT conversation_id FROM conversation_members
+    GROUP BY conversation_id
+    HAVING COUNT(*) = 2 AND bool_or(user_id = sqlc.arg('user_a')) AND bool_or(user_id = sqlc.arg('user_b'))
+)
+LIMIT 1;
+
+-- name: GetConversationMember :one
+SELECT * FROM conversation_members WHERE conversation_id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: LeaveConversation :execrows
+DELETE FROM conversation_members WHERE conversation_id = $1 AND user_id = $2;
+
+-- name: ListConversationMembers :many
+SELECT user_id FROM conversation_members WHERE conversation_id = $1 ORDER BY joined_at, user_id;
+
+-- name: ListUserConversations :many
+SELECT c.id, c.created_at, c.last_message_at, m.last_read_at,
+    (SELECT array_agg(cm.user_id ORDER BY cm.joined_at, cm.user_id) FROM conversation_members cm WHERE cm.conversation_id = c.id)::UUID[] AS member_ids,
+    (SELECT COUNT(*) FROM messages msg
+     WHERE msg.conversation_id = c.id AND msg.sender_id <> m.user_id
+     AND (m.last_read_at IS NULL OR msg.created_at > m.last_read_at))::INT AS unread
+FROM conversations c
+JOIN conversation_members m ON m.conversation_id = c.id
+WHERE m.user_id = $1
+ORDER BY COALESCE(c.last_message_at, c.created_at) DESC
+LIMIT 100;
+
+-- name: MarkConversationRead :execrows
+UPDATE conversation_members SET last_read_at = NOW() WHERE conversation_id = $1 AND user_id = $2;
+
+-- name: CreateMessage :one
+WITH message AS (
+    INSERT INTO messages (id, created_at, conversation_id, sender_id, body)
+    VALUES (gen_random_uuid(), NOW(), $1, $2, $3)
+    RETURNING *
+), touched AS (
+    UPDATE conversations SET last_message_at = message.created_at, updated_at = NOW()
+    FROM message WHERE conversations.id = message.conversation_id
+)
+SELECT * FROM message;
+
+-- name: ListMessages :many
+SELECT * FROM messages
+WHERE conversation_id = sqlc.arg('conversation_id') AND created_at < COALESCE(sqlc.narg('before')::TIMESTAMP, NOW())
+ORDER BY created_at DESC
+LIMIT sqlc.arg('max_messages');
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (token_hash, created_at, expires_at, email, user_id)
+VALUES (
+    $1, NOW(), $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetEmailVerificationToken :one
+SELECT * FROM email_verification_tokens WHERE token_hash = $1 LIMIT 1;
+
+-- name: UseEmailVerificationToken :execrows
+UPDATE email_verification_tokens SET used_at = NOW() WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW();
\ No newline at end of file
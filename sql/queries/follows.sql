@@ -0,0 +1,21 @@
+-- name: FollowUser :execrows
+WITH followed AS (
+    INSERT INTO follows (follower_id, followee_id, created_at)
+    VALUES ($1, $2, NOW())
+    ON CONFLICT (follower_id, followee_id) DO NOTHING
+    RETURNING follower_id, followee_id, created_at
+)
+INSERT INTO outbox_events (created_at, type, user_id, payload)
+SELECT NOW(), 'follow.created', followee_id, jsonb_build_object('follower_id', follower_id, 'user_id', followee_id, 'created_at', created_at)
+FROM followed;
+
+-- name: ListFolloweeIDs :many
+SELECT followee_id FROM follows WHERE follower_id = $1;
+
+-- name: IsFollowing :one
+SELECT EXISTS (
+    SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2
+);
+
+-- name: UnfollowUser :execrows
+DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2;
\ No newline at end of file
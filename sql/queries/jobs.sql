@@ -0,0 +1,46 @@
+-- name: CreateJob :one
+INSERT INTO jobs (id, created_at, updated_at, type, status, payload, user_id)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, 'pending', $2, $3
+)
+RETURNING *;
+
+-- name: GetJob :one
+SELECT * FROM jobs WHERE id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: GetActiveJob :one
+SELECT * FROM jobs WHERE user_id = $1 AND type = $2 AND status IN ('pending', 'running') ORDER BY created_at DESC LIMIT 1;
+
+-- name: ListJobIDsByUser :many
+SELECT id FROM jobs WHERE user_id = $1 AND type = $2;
+
+-- name: ListJobPayloadsByUser :many
+SELECT payload FROM jobs WHERE user_id = $1 AND type = $2;
+
+-- name: ClaimJob :one
+UPDATE jobs SET status = 'running', attempts = attempts + 1, started_at = NOW(), updated_at = NOW()
+WHERE id = (
+    SELECT id FROM jobs
+    WHERE (status = 'pending' OR (status = 'running' AND updated_at < NOW() - INTERVAL '10 minutes'))
+    AND attempts < 3
+    ORDER BY created_at
+    FOR UPDATE SKIP LOCKED
+    LIMIT 1
+)
+RETURNING *;
+
+-- name: FailAbandonedJobs :exec
+UPDATE jobs SET status = 'failed', error = 'job was interrupted too often', finished_at = NOW(), updated_at = NOW()
+WHERE status = 'running' AND updated_at < NOW() - INTERVAL '10 minutes' AND attempts >= 3;
+
+-- name: TouchJob :exec
+UPDATE jobs SET updated_at = NOW() WHERE id = $1 AND status = 'running';
+
+-- name: UpdateJobProgress :exec
+UPDATE jobs SET result = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: CompleteJob :exec
+UPDATE jobs SET status = 'done', result = $2, finished_at = NOW(), updated_at = NOW() WHERE id = $1;
+
+-- name: FailJob :exec
+UPDATE jobs SET status = 'failed', error = $2, finished_at = NOW(), updated_at = NOW() WHERE id = $1;
\ No newline at end of file
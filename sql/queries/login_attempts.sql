@@ -0,0 +1,21 @@
+-- name: GetLoginAttempt :one
+SELECT * FROM login_attempts WHERE key = $1 LIMIT 1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (key, failures, last_failure_at)
+VALUES (
+    $1, 1, NOW()
+)
+ON CONFLICT (key) DO UPDATE SET
+    failures = CASE
+        WHEN login_attempts.last_failure_at < NOW() - make_interval(secs => sqlc.arg(reset_after_seconds)::int) THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure_at = NOW()
+RETURNING *;
+
+-- name: LockLoginAttempt :exec
+UPDATE login_attempts SET locked_until = NOW() + make_interval(secs => sqlc.arg(lock_seconds)::int) WHERE key = $1;
+
+-- name: DeleteLoginAttempt :exec
+DELETE FROM login_attempts WHERE key = $1;
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- name: CreateMagicLinkToken :one
+INSERT INTO magic_link_tokens (token_hash, created_at, expires_at, nonce_hash, user_id)
+VALUES (
+    $1, NOW(), $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetMagicLinkToken :one
+SELECT * FROM magic_link_tokens WHERE token_hash = $1 LIMIT 1;
+
+-- name: UseMagicLinkToken :execrows
+UPDATE magic_link_tokens SET used_at = NOW() WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW();
\ No newline at end of file
@@ -0,0 +1,37 @@
+-- name: CreateNotification :execrows
+INSERT INTO notifications (id, created_at, updated_at, user_id, actor_id, type, target_id)
+SELECT gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4
+WHERE NOT EXISTS (
+    SELECT 1 FROM notification_preferences p WHERE p.user_id = $1 AND p.type = $3 AND NOT p.enabled
+);
+
+-- name: ListNotificationGroups :many
+SELECT type, target_id,
+    COUNT(DISTINCT actor_id)::INT AS actor_count,
+    (COUNT(*) FILTER (WHERE read_at IS NULL))::INT AS unread,
+    MAX(created_at)::TIMESTAMP AS latest_at,
+    ((array_agg(actor_id ORDER BY created_at DESC))[1:3])::UUID[] AS actor_ids
+FROM notifications
+WHERE user_id = sqlc.arg('user_id')
+GROUP BY type, target_id
+HAVING MAX(created_at) < COALESCE(sqlc.narg('before')::TIMESTAMP, NOW())
+ORDER BY latest_at DESC
+LIMIT sqlc.arg('max_groups');
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationsRead :execrows
+UPDATE notifications SET read_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND type = $2 AND target_id IS NOT DISTINCT FROM $3 AND read_at IS NULL;
+
+-- name: MarkAllNotificationsRead :execrows
+UPDATE notifications SET read_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: ListNotificationPreferences :many
+SELECT * FROM notification_preferences WHERE user_id = $1;
+
+-- name: UpsertNotificationPreference :exec
+INSERT INTO notification_preferences (user_id, type, enabled)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled;
\ No newline at end of file
@@ -0,0 +1,22 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, updated_at, name, secret_hash, redirect_uris, scopes, user_id)
+VALUES (
+    $1, NOW(), NOW(), $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients WHERE id = $1 LIMIT 1;
+
+-- name: CreateOAuthCode :one
+INSERT INTO oauth_authorization_codes (code_hash, created_at, expires_at, redirect_uri, scopes, code_challenge, client_id, user_id)
+VALUES (
+    $1, NOW(), $2, $3, $4, $5, $6, $7
+)
+RETURNING *;
+
+-- name: GetOAuthCode :one
+SELECT * FROM oauth_authorization_codes WHERE code_hash = $1 LIMIT 1;
+
+-- name: UseOAuthCode :execrows
+UPDATE oauth_authorization_codes SET used_at = NOW() WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW();
\ No newline at end of file
@@ -0,0 +1,27 @@
+-- name: GetOutboxCursor :one
+SELECT last_id FROM outbox_cursors WHERE name = $1;
+
+-- name: ListOutboxEventsAfter :many
+SELECT * FROM outbox_events
+WHERE id > $1 AND created_at < NOW() - INTERVAL '5 seconds'
+ORDER BY id
+LIMIT $2;
+
+-- name: UpdateOutboxCursor :exec
+UPDATE outbox_cursors SET last_id = $2 WHERE name = $1 AND last_id < $2;
+
+-- name: GetLatestOutboxEventID :one
+SELECT COALESCE(MAX(id), 0)::BIGINT AS last_id FROM outbox_events;
+
+-- name: ListOutboxEventsSince :many
+SELECT sqlc.embed(outbox_events), created_at < NOW() - INTERVAL '5 seconds' AS settled
+FROM outbox_events WHERE id > $1 ORDER BY id LIMIT $2;
+
+-- name: ListChirpEventsAfter :many
+SELECT * FROM outbox_events
+WHERE id > sqlc.arg('after_id')
+AND created_at > NOW() - INTERVAL '24 hours'
+AND type IN ('chirp.created', 'chirp.deleted')
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+ORDER BY id
+LIMIT sqlc.arg('max_events');
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (token_hash, created_at, expires_at, user_id)
+VALUES (
+    $1, NOW(), $2, $3
+)
+RETURNING *;
+
+-- name: GetPasswordResetToken :one
+SELECT * FROM password_reset_tokens WHERE token_hash = $1 LIMIT 1;
+
+-- name: UsePasswordResetToken :execrows
+UPDATE password_reset_tokens SET used_at = NOW() WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW();
+
+-- name: DeletePasswordResetTokensForUser :exec
+DELETE FROM password_reset_tokens WHERE user_id = $1;
\ No newline at end of file
@@ -0,0 +1,18 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, created_at, updated_at, name, token_hash, scopes, expires_at, user_id)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT * FROM personal_access_tokens WHERE token_hash = $1 LIMIT 1;
+
+-- name: ListPersonalAccessTokens :many
+SELECT * FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at DESC;
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens SET last_used_at = NOW() WHERE id = $1;
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
\ No newline at end of file
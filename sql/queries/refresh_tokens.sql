@@ -5,8 +5,21 @@ VALUES (
 )
 RETURNING *;
 
+-- name: CreateClientToken :one
+INSERT INTO refresh_tokens (token, created_at, updated_at, expires_at, user_id, client_id, scopes)
+VALUES (
+    $1, NOW(), NOW(), $2, $3, $4, $5
+)
+RETURNING *;
+
 -- name: GetOneToken :one
 SELECT * FROM refresh_tokens WHERE token = $1 ORDER BY created_at DESC LIMIT 1;
 
 -- name: RevokeToken :exec
-UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE token = $1;
\ No newline at end of file
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE token = $1;
+
+-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: ListUserTokens :many
+SELECT * FROM refresh_tokens WHERE user_id = $1 ORDER BY created_at DESC;
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- name: DeleteExpiredRevokedJWTs :exec
+DELETE FROM revoked_jwts WHERE expires_at < NOW();
+
+-- name: IsJWTRevoked :one
+SELECT EXISTS (SELECT 1 FROM revoked_jwts WHERE jti = $1);
+
+-- name: RevokeJWT :exec
+INSERT INTO revoked_jwts (jti, created_at, expires_at)
+VALUES (
+    $1, NOW(), $2
+)
+ON CONFLICT (jti) DO NOTHING;
\ No newline at end of file
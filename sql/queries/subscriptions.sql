@@ -0,0 +1,26 @@
+-- name: EnsureSubscription :exec
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, 'canceled'
+)
+ON CONFLICT (user_id) DO NOTHING;
+
+-- name: GetSubscription :one
+SELECT * FROM subscriptions WHERE user_id = $1 LIMIT 1;
+
+-- name: GetSubscriptionForUpdate :one
+SELECT * FROM subscriptions WHERE user_id = $1 LIMIT 1 FOR UPDATE;
+
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_end, cancel_at_period_end, last_event_at)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT (user_id) DO UPDATE SET
+    plan = EXCLUDED.plan,
+    status = EXCLUDED.status,
+    current_period_end = EXCLUDED.current_period_end,
+    cancel_at_period_end = EXCLUDED.cancel_at_period_end,
+    last_event_at = EXCLUDED.last_event_at,
+    updated_at = NOW()
+RETURNING *;
\ No newline at end of file
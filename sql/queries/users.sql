@@ -5,6 +5,13 @@ VALUES (
 )
 RETURNING *;
 
+-- name: CreateVerifiedUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, email_verified_at)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, NOW()
+)
+RETURNING *;
+
 -- name: SelectUserByEmail :one
 SELECT * FROM users WHERE email like $1 LIMIT 1;
 
@@ -15,7 +22,54 @@ SELECT * FROM users WHERE id = $1 LIMIT 1;
 DELETE FROM users;
 
 -- name: UpdateEmailAndPassword :exec
-UPDATE users SET hashed_password = $1, email =$2, updated_at = NOW() WHERE id = $3;
+UPDATE users SET hashed_password = $1, email = $2, email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END, updated_at = NOW() WHERE id = $3;
+
+-- name: UpdateDmPermission :exec
+UPDATE users SET dm_permission = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: UpdatePassword :exec
+UPDATE users SET hashed_password = $1, updated_at = NOW() WHERE id = $2;
+
+-- name: UpdateUsername :exec
+UPDATE users SET username = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: MarkEmailVerified :execrows
+UPDATE users SET email_verified_at = NOW(), updated_at = NOW() WHERE id = $1 AND email = $2;
 
--- name: UpdateChirpyRed :exec
-UPDATE users SET is_chirpy_red = $1, updated_at = NOW() WHERE id = $2;
\ No newline at end of file
+-- name: InvalidateUserTokens :exec
+UPDATE users SET tokens_valid_after = $2 WHERE id = $1;
+
+-- name: SetUserSuspended :execrows
+UPDATE users SET suspended_at = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: ScheduleUserDeletion :execrows
+WITH scheduled AS (
+    UPDATE users SET deletion_scheduled_at = $2, updated_at = NOW()
+    WHERE id = $1 AND deletion_scheduled_at IS NULL
+    RETURNING id, deletion_scheduled_at
+)
+INSERT INTO outbox_events (created_at, type, user_id, payload)
+SELECT NOW(), 'user.deletion_scheduled', id, jsonb_build_object('user_id', id, 'deletion_scheduled_at', deletion_scheduled_at)
+FROM scheduled;
+
+-- name: CancelUserDeletion :execrows
+WITH cancelled AS (
+    UPDATE users SET deletion_scheduled_at = NULL, updated_at = NOW()
+    WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+    RETURNING id
+)
+INSERT INTO outbox_events (created_at, type, user_id, payload)
+SELECT NOW(), 'user.deletion_cancelled', id, jsonb_build_object('user_id', id)
+FROM cancelled;
+
+-- name: ListUsersDueForDeletion :many
+SELECT id FROM users WHERE deletion_scheduled_at <= NOW() ORDER BY deletion_scheduled_at LIMIT $1;
+
+-- name: PurgeUser :execrows
+WITH deleted AS (
+    DELETE FROM users WHERE id = $1 AND deletion_scheduled_at <= NOW()
+    RETURNING id
+)
+INSERT INTO outbox_events (created_at, type, user_id, payload)
+SELECT NOW(), 'user.deleted', id, jsonb_build_object('user_id', id)
+FROM deleted;
\ No newline at end of file
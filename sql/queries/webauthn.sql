@@ -0,0 +1,33 @@
+-- name: CreateWebAuthnChallenge :one
+INSERT INTO webauthn_challenges (id, created_at, expires_at, ceremony, challenge, user_id)
+VALUES (
+    gen_random_uuid(), NOW(), $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (id, created_at, name, credential_id, public_key, sign_count, user_id)
+VALUES (
+    gen_random_uuid(), NOW(), $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: DeleteExpiredWebAuthnChallenges :execrows
+DELETE FROM webauthn_challenges WHERE expires_at <= NOW();
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2;
+
+-- name: GetWebAuthnCredential :one
+SELECT * FROM webauthn_credentials WHERE credential_id = $1 LIMIT 1;
+
+-- name: ListWebAuthnCredentials :many
+SELECT * FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at DESC;
+
+-- name: TakeWebAuthnChallenge :one
+DELETE FROM webauthn_challenges WHERE id = $1 AND ceremony = $2 AND expires_at > NOW()
+RETURNING *;
+
+-- name: UpdateWebAuthnSignCount :execrows
+UPDATE webauthn_credentials SET sign_count = $2, last_used_at = NOW()
+WHERE id = $1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0));
\ No newline at end of file
@@ -0,0 +1,56 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, updated_at, user_id, url, secret, events)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints WHERE id = $1 LIMIT 1;
+
+-- name: ListWebhookEndpoints :many
+SELECT * FROM webhook_endpoints WHERE user_id IS NOT DISTINCT FROM $1 ORDER BY created_at;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints WHERE id = $1 AND user_id IS NOT DISTINCT FROM $2;
+
+-- name: DeleteOrphanedWebhookEndpoints :execrows
+DELETE FROM webhook_endpoints e
+WHERE e.user_id IS NOT NULL
+AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = e.user_id)
+AND NOT EXISTS (
+    SELECT 1 FROM outbox_events o, outbox_cursors c
+    WHERE c.name = $1 AND o.id > c.last_id AND o.user_id = e.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM webhook_deliveries d
+    WHERE d.endpoint_id = e.id AND d.status = 'pending'
+);
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, created_at, updated_at, endpoint_id, event_id, event_type, payload, status, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), NOW(), e.id, $1, $2, $3, 'pending', NOW()
+FROM webhook_endpoints e
+WHERE $2 = ANY(string_to_array(e.events, ' '))
+AND (e.user_id IS NULL OR e.user_id = $4)
+ON CONFLICT (endpoint_id, event_id) DO NOTHING;
+
+-- name: ClaimWebhookDelivery :one
+UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = NOW() + INTERVAL '5 minutes', updated_at = NOW()
+WHERE id = (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at
+    FOR UPDATE SKIP LOCKED
+    LIMIT 1
+)
+RETURNING *;
+
+-- name: CompleteWebhookDelivery :exec
+UPDATE webhook_deliveries SET status = 'delivered', response_code = $2, error = NULL, delivered_at = NOW(), updated_at = NOW() WHERE id = $1;
+
+-- name: RetryWebhookDelivery :exec
+UPDATE webhook_deliveries SET status = $2, response_code = $3, error = $4, next_attempt_at = NOW() + LEAST(INTERVAL '30 seconds' * power(2, GREATEST(attempts - 1, 0)), INTERVAL '12 hours'), updated_at = NOW() WHERE id = $1;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries WHERE endpoint_id = $1 ORDER BY created_at DESC LIMIT $2;
\ No newline at end of file
@@ -0,0 +1,20 @@
+-- name: RecordWebhookEvent :one
+INSERT INTO webhook_events (id, created_at, updated_at, provider, event_id, event_type, status, payload)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, 'received', $4
+)
+ON CONFLICT (provider, event_id) DO UPDATE SET attempts = webhook_events.attempts + 1, updated_at = NOW()
+WHERE webhook_events.status = 'failed'
+    OR (webhook_events.status = 'received' AND webhook_events.updated_at < NOW() - INTERVAL '5 minutes')
+RETURNING *;
+
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events WHERE status = $1 ORDER BY created_at DESC LIMIT $2;
+
+-- name: ReplayWebhookEvent :one
+UPDATE webhook_events SET attempts = attempts + 1, updated_at = NOW() WHERE id = $1
+    AND (status = 'failed' OR (status = 'received' AND updated_at < NOW() - INTERVAL '5 minutes'))
+RETURNING *;
+
+-- name: MarkWebhookEvent :exec
+UPDATE webhook_events SET status = $2, error = $3, processed_at = NOW(), updated_at = NOW() WHERE id = $1;
\ No newline at end of file
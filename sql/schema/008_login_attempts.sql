@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE login_attempts (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NULL
+);
+
+-- +goose Down
+DROP TABLE login_attempts;
\ No newline at end of file
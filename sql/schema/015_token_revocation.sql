@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN tokens_valid_after TIMESTAMP NULL,
+ADD COLUMN suspended_at TIMESTAMP NULL;
+
+CREATE TABLE revoked_jwts (
+    jti TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE revoked_jwts;
+
+ALTER TABLE users
+DROP COLUMN suspended_at,
+DROP COLUMN tokens_valid_after;
\ No newline at end of file
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    type TEXT NOT NULL,
+    user_id UUID NULL,
+    payload JSONB NOT NULL
+);
+
+-- +goose Down
+DROP TABLE outbox_events;
\ No newline at end of file
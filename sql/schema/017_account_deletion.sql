@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN deletion_scheduled_at TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN deletion_scheduled_at;
\ No newline at end of file
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    result JSONB NOT NULL DEFAULT '{}',
+    error TEXT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NULL,
+    finished_at TIMESTAMP NULL,
+    user_id UUID NOT NULL,
+    CONSTRAINT fk_user FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX jobs_status_idx ON jobs (status, created_at);
+
+-- +goose Down
+DROP TABLE jobs;
\ No newline at end of file
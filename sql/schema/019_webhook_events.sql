@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE webhook_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    provider TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    error TEXT NULL,
+    attempts INT NOT NULL DEFAULT 1,
+    processed_at TIMESTAMP NULL,
+    UNIQUE (provider, event_id)
+);
+
+CREATE INDEX webhook_events_status_idx ON webhook_events (status, created_at);
+
+-- +goose Down
+DROP TABLE webhook_events;
\ No newline at end of file
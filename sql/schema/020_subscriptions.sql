@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL UNIQUE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL,
+    current_period_end TIMESTAMP NULL,
+    cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+    CONSTRAINT fk_user FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO subscriptions (created_at, updated_at, user_id, plan, status)
+SELECT NOW(), NOW(), id, 'chirpy_red', 'active' FROM users WHERE is_chirpy_red;
+
+ALTER TABLE users DROP COLUMN is_chirpy_red;
+
+-- +goose Down
+ALTER TABLE users ADD COLUMN is_chirpy_red BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET is_chirpy_red = TRUE
+WHERE id IN (SELECT user_id FROM subscriptions WHERE status IN ('active', 'past_due'));
+
+DROP TABLE subscriptions;
\ No newline at end of file
@@ -0,0 +1,46 @@
+-- +goose Up
+CREATE TABLE webhook_endpoints (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL,
+    CONSTRAINT fk_user FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    endpoint_id UUID NOT NULL,
+    event_id BIGINT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    response_code INT NULL,
+    error TEXT NULL,
+    delivered_at TIMESTAMP NULL,
+    UNIQUE (endpoint_id, event_id),
+    CONSTRAINT fk_endpoint FOREIGN KEY (endpoint_id)
+    REFERENCES webhook_endpoints(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_status_idx ON webhook_deliveries (status, next_attempt_at);
+
+CREATE TABLE outbox_cursors (
+    name TEXT PRIMARY KEY,
+    last_id BIGINT NOT NULL
+);
+
+INSERT INTO outbox_cursors (name, last_id)
+SELECT 'webhooks', COALESCE(MAX(id), 0) FROM outbox_events;
+
+-- +goose Down
+DROP TABLE outbox_cursors;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_endpoints;
\ No newline at end of file
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE FUNCTION notify_outbox_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('outbox_events', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER outbox_events_notify
+AFTER INSERT ON outbox_events
+FOR EACH ROW EXECUTE FUNCTION notify_outbox_event();
+
+-- +goose Down
+DROP TRIGGER outbox_events_notify ON outbox_events;
+DROP FUNCTION notify_outbox_event();
\ No newline at end of file
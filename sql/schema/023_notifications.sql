@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    actor_id UUID NOT NULL,
+    type TEXT NOT NULL,
+    target_id UUID NULL,
+    read_at TIMESTAMP NULL,
+    CONSTRAINT fk_user FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_actor FOREIGN KEY (actor_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_idx ON notifications (user_id, type, target_id);
+CREATE INDEX notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+
+CREATE TABLE notification_preferences (
+    user_id UUID NOT NULL,
+    type TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, type),
+    CONSTRAINT fk_user FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE notification_preferences;
+DROP TABLE notifications;
\ No newline at end of file
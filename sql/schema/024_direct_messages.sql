@@ -0,0 +1,49 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN dm_permission TEXT NOT NULL DEFAULT 'everyone';
+
+CREATE TABLE conversations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    created_by UUID NULL,
+    last_message_at TIMESTAMP NULL,
+    CONSTRAINT fk_creator FOREIGN KEY (created_by)
+    REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE conversation_members (
+    conversation_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    joined_at TIMESTAMP NOT NULL,
+    last_read_at TIMESTAMP NULL,
+    PRIMARY KEY (conversation_id, user_id),
+    CONSTRAINT fk_conversation FOREIGN KEY (conversation_id)
+    REFERENCES conversations(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX conversation_members_user_idx ON conversation_members (user_id);
+
+CREATE TABLE messages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL,
+    conversation_id UUID NOT NULL,
+    sender_id UUID NOT NULL,
+    body TEXT NOT NULL,
+    CONSTRAINT fk_conversation FOREIGN KEY (conversation_id)
+    REFERENCES conversations(id) ON DELETE CASCADE,
+    CONSTRAINT fk_sender FOREIGN KEY (sender_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX messages_conversation_idx ON messages (conversation_id, created_at);
+
+-- +goose Down
+DROP TABLE messages;
+DROP TABLE conversation_members;
+DROP TABLE conversations;
+
+ALTER TABLE users
+DROP COLUMN dm_permission;
\ No newline at end of file
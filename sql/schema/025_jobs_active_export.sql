@@ -0,0 +1,16 @@
+-- +goose Up
+-- Only one export per user may be queued or running. Older duplicates left
+-- by concurrent requests are failed so the index can be built.
+UPDATE jobs SET status = 'failed', error = 'superseded by another export', finished_at = NOW(), updated_at = NOW()
+WHERE type = 'export' AND status IN ('pending', 'running')
+AND id NOT IN (
+    SELECT DISTINCT ON (user_id) id FROM jobs
+    WHERE type = 'export' AND status IN ('pending', 'running')
+    ORDER BY user_id, created_at DESC
+);
+
+CREATE UNIQUE INDEX jobs_active_export_idx ON jobs (user_id, type)
+WHERE type = 'export' AND status IN ('pending', 'running');
+
+-- +goose Down
+DROP INDEX jobs_active_export_idx;
\ No newline at end of file
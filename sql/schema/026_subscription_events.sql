@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE subscriptions ADD COLUMN last_event_at TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE subscriptions DROP COLUMN last_event_at;
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Endpoints of a user outlive the account until the user.deleted event has
+-- been delivered to them. The webhook worker removes them afterwards.
+ALTER TABLE webhook_endpoints DROP CONSTRAINT fk_user;
+
+-- +goose Down
+DELETE FROM webhook_endpoints e
+WHERE e.user_id IS NOT NULL
+AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = e.user_id);
+
+ALTER TABLE webhook_endpoints ADD CONSTRAINT fk_user FOREIGN KEY (user_id)
+REFERENCES users(id) ON DELETE CASCADE;
\ No newline at end of file
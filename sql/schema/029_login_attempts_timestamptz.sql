@@ -0,0 +1,11 @@
+-- +goose Up
+-- The times are compared across the app and the database, so they are
+-- stored as absolute points in time.
+ALTER TABLE login_attempts
+ALTER COLUMN last_failure_at TYPE TIMESTAMPTZ,
+ALTER COLUMN locked_until TYPE TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE login_attempts
+ALTER COLUMN last_failure_at TYPE TIMESTAMP,
+ALTER COLUMN locked_until TYPE TIMESTAMP;
\ No newline at end of file
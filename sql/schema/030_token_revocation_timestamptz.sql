@@ -0,0 +1,17 @@
+-- +goose Up
+-- tokens_valid_after is written by the app and compared with token issue
+-- times, expires_at with NOW(). Both need absolute points in time.
+ALTER TABLE users
+ALTER COLUMN tokens_valid_after TYPE TIMESTAMPTZ;
+
+ALTER TABLE revoked_jwts
+ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+ALTER COLUMN expires_at TYPE TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE revoked_jwts
+ALTER COLUMN created_at TYPE TIMESTAMP,
+ALTER COLUMN expires_at TYPE TIMESTAMP;
+
+ALTER TABLE users
+ALTER COLUMN tokens_valid_after TYPE TIMESTAMP;
\ No newline at end of file
@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN username TEXT NULL UNIQUE;
+
+CREATE TABLE follows (
+    follower_id UUID NOT NULL,
+    followee_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (follower_id, followee_id),
+    CONSTRAINT fk_follower FOREIGN KEY (follower_id)
+    REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_followee FOREIGN KEY (followee_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX follows_followee_idx ON follows (followee_id);
+
+-- +goose Down
+DROP TABLE follows;
+
+ALTER TABLE users
+DROP COLUMN username;
\ No newline at end of file
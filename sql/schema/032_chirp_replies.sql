@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN reply_to UUID NULL,
+ADD CONSTRAINT fk_reply_to FOREIGN KEY (reply_to)
+REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE INDEX chirps_reply_to_idx ON chirps (reply_to);
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN reply_to;
\ No newline at end of file
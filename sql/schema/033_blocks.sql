@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE blocks (
+    blocker_id UUID NOT NULL,
+    blocked_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CONSTRAINT fk_blocker FOREIGN KEY (blocker_id)
+    REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_blocked FOREIGN KEY (blocked_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX blocks_blocked_idx ON blocks (blocked_id);
+
+-- +goose Down
+DROP TABLE blocks;
\ No newline at end of file